@@ -0,0 +1,221 @@
+package tfc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Artifact retention modes.
+const (
+	KeepAllArtifacts    = "all"
+	KeepFailedArtifacts = "failed"
+	KeepNoArtifacts     = "none"
+)
+
+// ArtifactRetention decides how long the channel artifacts and client
+// configs of the games are kept. Each run writes them to its own workspace
+// under Root, one folder per game. Keep is one of:
+//   - all: the folders of all games
+//   - failed: the folders of the failed games
+//   - none: no folders, once the games are over
+//
+// Whatever is kept, the workspace lists the files of each game in its
+// artifacts.jsonl. The workspaces of old runs are removed when a new run
+// starts, once there are more than MaxRuns, or they are older than MaxAge.
+type ArtifactRetention struct {
+	// Root defaults to $SCFIXTURES/tfc/temp.
+	Root string `yaml:"root"`
+	Keep string `yaml:"keep"`
+	// MaxRuns counts the workspace of the new run. Zero keeps any number of
+	// workspaces.
+	MaxRuns int `yaml:"maxRuns"`
+	// MaxAge of zero keeps workspaces of any age.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// DefaultArtifactRetention keeps the artifacts of all games, for the last ten
+// runs.
+func DefaultArtifactRetention() ArtifactRetention {
+	return ArtifactRetention{
+		Root:    path.Join(scfixturesPath, "temp"),
+		Keep:    KeepAllArtifacts,
+		MaxRuns: 10,
+	}
+}
+
+// Validate checks the retention.
+func (ar ArtifactRetention) Validate() error {
+	if ar.Root == "" {
+		return fmt.Errorf("artifacts need a root folder")
+	}
+	switch ar.Keep {
+	case KeepAllArtifacts, KeepFailedArtifacts, KeepNoArtifacts:
+	default:
+		return fmt.Errorf("unknown artifact retention %q", ar.Keep)
+	}
+	if ar.MaxRuns < 0 || ar.MaxAge < 0 {
+		return fmt.Errorf("artifact retention can not be negative")
+	}
+	return nil
+}
+
+// StartArtifactRun makes the games of the config write their artifacts to the
+// workspace of the run, and removes the workspaces of old runs beyond the
+// retention.
+func (cfg *RunConfig) StartArtifactRun(retention ArtifactRetention, runID string) error {
+	if err := retention.Validate(); err != nil {
+		return err
+	}
+	m := newArtifactManager(retention, runID)
+	removed, err := m.collect(time.Now())
+	for _, r := range removed {
+		log.Printf("Removed the artifacts of the old run %s", r)
+	}
+	if err != nil {
+		return fmt.Errorf("could not remove old artifacts: %s", err)
+	}
+	cfg.artifacts = m
+	return nil
+}
+
+// artifactRecord lists the files created by a game.
+type artifactRecord struct {
+	Game   string   `json:"game"`
+	Failed bool     `json:"failed"`
+	Kept   bool     `json:"kept"`
+	Files  []string `json:"files"`
+}
+
+// artifactManager hands out the folders of the games of a run, and records
+// the files created in them. The workspace of the run is created with its
+// first game. It is safe for concurrent use.
+type artifactManager struct {
+	retention ArtifactRetention
+	runDir    string
+
+	lock  sync.Mutex
+	games map[string][]string
+}
+
+func newArtifactManager(retention ArtifactRetention, runID string) *artifactManager {
+	return &artifactManager{
+		retention: retention,
+		runDir:    path.Join(retention.Root, runID),
+		games:     make(map[string][]string),
+	}
+}
+
+// workspace creates the folder of the game.
+func (m *artifactManager) workspace(gameName string) (string, error) {
+	gameDir := path.Join(m.runDir, gameName)
+	err := os.MkdirAll(gameDir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("could not create the artifact folder of %s: %s", gameName, err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.games[gameName]; !ok {
+		m.games[gameName] = []string{}
+	}
+	return gameDir, nil
+}
+
+// record adds the files to the ones created by the game.
+func (m *artifactManager) record(gameName string, files ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.games[gameName] = append(m.games[gameName], files...)
+}
+
+// finish removes the folder of the game, unless the retention keeps it, and
+// lists its files in the artifacts.jsonl of the run. Games without a folder
+// are ignored.
+func (m *artifactManager) finish(gameName string, gameErr error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	files, ok := m.games[gameName]
+	if !ok {
+		return nil
+	}
+	delete(m.games, gameName)
+
+	rec := artifactRecord{Game: gameName, Failed: gameErr != nil, Files: files}
+	rec.Kept = m.retention.Keep == KeepAllArtifacts ||
+		(m.retention.Keep == KeepFailedArtifacts && rec.Failed)
+	if !rec.Kept {
+		err := os.RemoveAll(path.Join(m.runDir, gameName))
+		if err != nil {
+			return fmt.Errorf("could not remove the artifacts of %s: %s", gameName, err)
+		}
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	manifest, err := os.OpenFile(path.Join(m.runDir, "artifacts.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not record the artifacts of %s: %s", gameName, err)
+	}
+	defer manifest.Close()
+	_, err = manifest.Write(append(data, '\n'))
+	if err != nil {
+		return fmt.Errorf("could not record the artifacts of %s: %s", gameName, err)
+	}
+	return nil
+}
+
+// collect removes the workspaces of the old runs which are older than the
+// MaxAge, or not among the MaxRuns - 1 newest ones, and returns them.
+func (m *artifactManager) collect(now time.Time) ([]string, error) {
+	entries, err := ioutil.ReadDir(m.retention.Root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []os.FileInfo{}
+	for _, e := range entries {
+		if e.IsDir() && path.Join(m.retention.Root, e.Name()) != m.runDir {
+			runs = append(runs, e)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ModTime().After(runs[j].ModTime())
+	})
+
+	removed := []string{}
+	for i, r := range runs {
+		tooMany := m.retention.MaxRuns > 0 && i+1 >= m.retention.MaxRuns
+		tooOld := m.retention.MaxAge > 0 && now.Sub(r.ModTime()) > m.retention.MaxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		err := os.RemoveAll(path.Join(m.retention.Root, r.Name()))
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, r.Name())
+	}
+	return removed, nil
+}
+
+// finishGameArtifacts settles the artifacts of a game once it is over. A
+// failure to do so does not fail the game.
+func (cfg *RunConfig) finishGameArtifacts(gameName string, gameErr error) {
+	err := cfg.artifacts.finish(gameName, gameErr)
+	if err != nil {
+		log.Printf("Could not settle the artifacts of %s: %s", gameName, err)
+	}
+}
@@ -0,0 +1,116 @@
+package tfc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// playArtifacts creates the folder and a file of each game, and finishes the
+// games with the errors.
+func playArtifacts(t *testing.T, m *artifactManager, games map[string]error) {
+	for game, err := range games {
+		dir, wErr := m.workspace(game)
+		require.NoError(t, wErr)
+		cfgPath := filepath.Join(dir, "Player1Config.yaml")
+		require.NoError(t, ioutil.WriteFile(cfgPath, []byte("client: {}"), 0644))
+		m.record(game, cfgPath)
+		require.NoError(t, m.finish(game, err))
+	}
+}
+
+func readArtifactRecords(t *testing.T, m *artifactManager) map[string]artifactRecord {
+	data, err := ioutil.ReadFile(filepath.Join(m.runDir, "artifacts.jsonl"))
+	require.NoError(t, err)
+	records := map[string]artifactRecord{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		rec := artifactRecord{}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		records[rec.Game] = rec
+	}
+	return records
+}
+
+func TestArtifactRetention(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifacts")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	games := map[string]error{"won": nil, "lost": errors.New("timeout")}
+	kept := map[string][]string{
+		KeepAllArtifacts:    {"lost", "won"},
+		KeepFailedArtifacts: {"lost"},
+		KeepNoArtifacts:     {},
+	}
+	for keep, expected := range kept {
+		m := newArtifactManager(ArtifactRetention{Root: root, Keep: keep}, keep)
+		playArtifacts(t, m, games)
+
+		entries, err := ioutil.ReadDir(m.runDir)
+		require.NoError(t, err)
+		dirs := []string{}
+		for _, e := range entries {
+			if e.IsDir() {
+				dirs = append(dirs, e.Name())
+			}
+		}
+		require.Equal(t, expected, dirs, "unexpected artifacts kept by %s", keep)
+
+		records := readArtifactRecords(t, m)
+		require.Len(t, records, 2)
+		require.True(t, records["lost"].Failed)
+		require.Equal(t, []string{filepath.Join(m.runDir, "won", "Player1Config.yaml")}, records["won"].Files)
+	}
+
+	m := newArtifactManager(DefaultArtifactRetention(), "unused")
+	require.NoError(t, m.finish("simulated", nil), "expected games without artifacts to be ignored")
+}
+
+func TestArtifactCollection(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifacts")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	now := time.Now()
+	for i, run := range []string{"run1", "run2", "run3", "run4"} {
+		runDir := filepath.Join(root, run)
+		require.NoError(t, os.Mkdir(runDir, 0755))
+		modTime := now.Add(time.Duration(i-4) * time.Hour)
+		require.NoError(t, os.Chtimes(runDir, modTime, modTime))
+	}
+
+	m := newArtifactManager(ArtifactRetention{Root: root, Keep: KeepAllArtifacts, MaxRuns: 3}, "run5")
+	removed, err := m.collect(now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"run2", "run1"}, removed, "expected room for the new run")
+
+	m = newArtifactManager(ArtifactRetention{Root: root, Keep: KeepAllArtifacts, MaxAge: 90 * time.Minute}, "run5")
+	removed, err = m.collect(now)
+	require.NoError(t, err)
+	require.Equal(t, []string{"run3"}, removed)
+
+	m = newArtifactManager(ArtifactRetention{Root: filepath.Join(root, "missing"), Keep: KeepAllArtifacts, MaxRuns: 1}, "run5")
+	removed, err = m.collect(now)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+}
+
+func TestArtifactRetentionRejectsInvalid(t *testing.T) {
+	require.NoError(t, DefaultArtifactRetention().Validate())
+	retentions := map[string]ArtifactRetention{
+		"no root":       {Keep: KeepAllArtifacts},
+		"unknown keep":  {Root: "temp", Keep: "some"},
+		"negative runs": {Root: "temp", Keep: KeepAllArtifacts, MaxRuns: -1},
+		"negative age":  {Root: "temp", Keep: KeepAllArtifacts, MaxAge: -time.Hour},
+	}
+	for name, ar := range retentions {
+		require.Error(t, ar.Validate(), "expected %s to be rejected", name)
+	}
+}
@@ -0,0 +1,320 @@
+package tfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Keys of the channel configuration, as defined by fabric.
+const (
+	applicationGroupKey = "Application"
+	consortiumKey       = "Consortium"
+	capabilitiesKey     = "Capabilities"
+	anchorPeersKey      = "AnchorPeers"
+	mspKey              = "MSP"
+	readersPolicyKey    = "Readers"
+	writersPolicyKey    = "Writers"
+	adminsPolicyKey     = "Admins"
+)
+
+// gameChannelProfile is the profile of configtx.yaml the game channels are
+// created from.
+const gameChannelProfile = "TFCChannel"
+
+// configtxData holds the orgs of the channel, and the network they are part
+// of.
+type configtxData struct {
+	Orgs    []NetworkOrg
+	Network Network
+}
+
+// channelProfile holds the application settings of a configtx.yaml profile.
+type channelProfile struct {
+	Consortium   string
+	Capabilities []string
+	// Policies are the implicit meta policies of the application group.
+	Policies map[string]*cb.ImplicitMetaPolicy
+}
+
+// configtxProfile is the part of a configtx.yaml profile the channel
+// artifacts are built from.
+type configtxProfile struct {
+	Consortium  string `yaml:"Consortium"`
+	Application *struct {
+		Policies map[string]struct {
+			Type string `yaml:"Type"`
+			Rule string `yaml:"Rule"`
+		} `yaml:"Policies"`
+		Capabilities map[string]bool `yaml:"Capabilities"`
+	} `yaml:"Application"`
+}
+
+// loadChannelProfile reads the application settings of the profile from a
+// configtx.yaml file.
+func loadChannelProfile(configtxPath, name string) (channelProfile, error) {
+	data, err := ioutil.ReadFile(configtxPath)
+	if err != nil {
+		return channelProfile{}, fmt.Errorf("could not read configtx: %s", err)
+	}
+	return parseChannelProfile(data, name)
+}
+
+// parseChannelProfile reads the application settings of the profile, the
+// way configtxgen does. Only implicit meta policies, such as "ANY Readers",
+// are supported for the application group.
+func parseChannelProfile(configtx []byte, name string) (channelProfile, error) {
+	top := struct {
+		Profiles map[string]configtxProfile `yaml:"Profiles"`
+	}{}
+	err := yaml.Unmarshal(configtx, &top)
+	if err != nil {
+		return channelProfile{}, fmt.Errorf("could not parse configtx: %s", err)
+	}
+
+	p, ok := top.Profiles[name]
+	if !ok {
+		return channelProfile{}, fmt.Errorf("configtx has no profile %s", name)
+	}
+	if p.Consortium == "" {
+		return channelProfile{}, fmt.Errorf("profile %s has no consortium", name)
+	}
+	if p.Application == nil {
+		return channelProfile{}, fmt.Errorf("profile %s has no application section", name)
+	}
+
+	profile := channelProfile{Consortium: p.Consortium, Policies: map[string]*cb.ImplicitMetaPolicy{}}
+	for c, enabled := range p.Application.Capabilities {
+		if enabled {
+			profile.Capabilities = append(profile.Capabilities, c)
+		}
+	}
+	sort.Strings(profile.Capabilities)
+
+	for key, policy := range p.Application.Policies {
+		if policy.Type != "ImplicitMeta" {
+			return channelProfile{}, fmt.Errorf("policy %s of profile %s has type %q, only ImplicitMeta is supported",
+				key, name, policy.Type)
+		}
+		fields := strings.Fields(policy.Rule)
+		if len(fields) != 2 {
+			return channelProfile{}, fmt.Errorf("policy %s of profile %s has invalid rule %q", key, name, policy.Rule)
+		}
+		rule, ok := cb.ImplicitMetaPolicy_Rule_value[fields[0]]
+		if !ok {
+			return channelProfile{}, fmt.Errorf("policy %s of profile %s has unknown rule %q", key, name, fields[0])
+		}
+		profile.Policies[key] = &cb.ImplicitMetaPolicy{SubPolicy: fields[1], Rule: cb.ImplicitMetaPolicy_Rule(rule)}
+	}
+	return profile, nil
+}
+
+// writeChannelArtifacts writes the channel creation transaction of the
+// channel, <channel>.tx, and the anchor peer update of each org,
+// <org>anchors.tx, to the cfgPath. It returns the files written.
+func writeChannelArtifacts(cfgPath, channelName string, profile channelProfile, orgs []NetworkOrg) ([]string, error) {
+	env, err := channelCreateTx(channelName, profile, orgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not build channel tx: %s", err)
+	}
+	chanTxPath := path.Join(cfgPath, channelName+".tx")
+	err = writeEnvelope(chanTxPath, env)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{chanTxPath}
+
+	for _, o := range orgs {
+		env, err := anchorPeersTx(channelName, o)
+		if err != nil {
+			return files, fmt.Errorf("could not build anchor peer update for %s: %s", o.Name, err)
+		}
+		anchorsPath := path.Join(cfgPath, o.Name+"anchors.tx")
+		err = writeEnvelope(anchorsPath, env)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, anchorsPath)
+	}
+	return files, nil
+}
+
+func writeEnvelope(filePath string, env *cb.Envelope) error {
+	data, err := marshal(env)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %s", filePath, err)
+	}
+	err = ioutil.WriteFile(filePath, data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %s", filePath, err)
+	}
+	return nil
+}
+
+// channelCreateTx builds the transaction creating the channel of the orgs,
+// as configtxgen -outputCreateChannelTx does. The read set holds the
+// consortium and the orgs, and the write set adds the application policies
+// and capabilities of the profile.
+func channelCreateTx(channelName string, profile channelProfile, orgs []NetworkOrg) (*cb.Envelope, error) {
+	if len(orgs) == 0 {
+		return nil, fmt.Errorf("channel %s has no orgs", channelName)
+	}
+
+	readOrgs, writeOrgs := map[string]*cb.ConfigGroup{}, map[string]*cb.ConfigGroup{}
+	for _, o := range orgs {
+		readOrgs[o.Name] = &cb.ConfigGroup{}
+		writeOrgs[o.Name] = &cb.ConfigGroup{}
+	}
+
+	policies := map[string]*cb.ConfigPolicy{}
+	for name, p := range profile.Policies {
+		value, err := marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		policies[name] = &cb.ConfigPolicy{
+			ModPolicy: adminsPolicyKey,
+			Policy:    &cb.Policy{Type: int32(cb.Policy_IMPLICIT_META), Value: value},
+		}
+	}
+
+	capabilities := &cb.Capabilities{Capabilities: map[string]*cb.Capability{}}
+	for _, c := range profile.Capabilities {
+		capabilities.Capabilities[c] = &cb.Capability{}
+	}
+	capabilitiesValue, err := marshal(capabilities)
+	if err != nil {
+		return nil, err
+	}
+	consortiumValue, err := marshal(&cb.Consortium{Name: profile.Consortium})
+	if err != nil {
+		return nil, err
+	}
+
+	update := &cb.ConfigUpdate{
+		ChannelId: channelName,
+		ReadSet: &cb.ConfigGroup{
+			Groups: map[string]*cb.ConfigGroup{
+				applicationGroupKey: {Groups: readOrgs},
+			},
+			Values: map[string]*cb.ConfigValue{
+				consortiumKey: {},
+			},
+		},
+		WriteSet: &cb.ConfigGroup{
+			Groups: map[string]*cb.ConfigGroup{
+				applicationGroupKey: {
+					Version:   1,
+					ModPolicy: adminsPolicyKey,
+					Groups:    writeOrgs,
+					Policies:  policies,
+					Values: map[string]*cb.ConfigValue{
+						capabilitiesKey: {ModPolicy: adminsPolicyKey, Value: capabilitiesValue},
+					},
+				},
+			},
+			Values: map[string]*cb.ConfigValue{
+				consortiumKey: {Value: consortiumValue},
+			},
+		},
+	}
+	return configUpdateEnvelope(update)
+}
+
+// anchorPeersTx builds the transaction setting the first peer of the org as
+// its anchor peer on the channel, as configtxgen -outputAnchorPeersUpdate
+// does.
+func anchorPeersTx(channelName string, org NetworkOrg) (*cb.Envelope, error) {
+	if len(org.Peers) == 0 {
+		return nil, fmt.Errorf("org %s has no peers", org.Name)
+	}
+	anchor := org.Peers[0]
+	anchorPeers, err := marshal(&pb.AnchorPeers{
+		AnchorPeers: []*pb.AnchorPeer{{Host: anchor.Host, Port: int32(anchor.Port)}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orgGroup := func() *cb.ConfigGroup {
+		return &cb.ConfigGroup{
+			Values: map[string]*cb.ConfigValue{
+				mspKey: {},
+			},
+			Policies: map[string]*cb.ConfigPolicy{
+				readersPolicyKey: {},
+				writersPolicyKey: {},
+				adminsPolicyKey:  {},
+			},
+		}
+	}
+	readOrg, writeOrg := orgGroup(), orgGroup()
+	writeOrg.Version = 1
+	writeOrg.ModPolicy = adminsPolicyKey
+	writeOrg.Values[anchorPeersKey] = &cb.ConfigValue{ModPolicy: adminsPolicyKey, Value: anchorPeers}
+
+	application := func(orgGroup *cb.ConfigGroup) *cb.ConfigGroup {
+		return &cb.ConfigGroup{
+			Version:   1,
+			ModPolicy: adminsPolicyKey,
+			Groups:    map[string]*cb.ConfigGroup{org.Name: orgGroup},
+		}
+	}
+	update := &cb.ConfigUpdate{
+		ChannelId: channelName,
+		ReadSet: &cb.ConfigGroup{
+			Groups: map[string]*cb.ConfigGroup{applicationGroupKey: application(readOrg)},
+		},
+		WriteSet: &cb.ConfigGroup{
+			Groups: map[string]*cb.ConfigGroup{applicationGroupKey: application(writeOrg)},
+		},
+	}
+	return configUpdateEnvelope(update)
+}
+
+// configUpdateEnvelope wraps the unsigned config update into a transaction.
+// The SDK signs the update when saving the channel, so the transaction has
+// no signature or timestamp.
+func configUpdateEnvelope(update *cb.ConfigUpdate) (*cb.Envelope, error) {
+	updateBytes, err := marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	data, err := marshal(&cb.ConfigUpdateEnvelope{ConfigUpdate: updateBytes})
+	if err != nil {
+		return nil, err
+	}
+	channelHeader, err := marshal(&cb.ChannelHeader{
+		ChannelId: update.ChannelId,
+		Type:      int32(cb.HeaderType_CONFIG_UPDATE),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := marshal(&cb.Payload{
+		Header: &cb.Header{ChannelHeader: channelHeader},
+		Data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &cb.Envelope{Payload: payload}, nil
+}
+
+// marshal encodes the message with sorted map keys, so the same channel
+// always has the same artifacts.
+func marshal(m proto.Message) ([]byte, error) {
+	b := proto.NewBuffer(nil)
+	b.SetDeterministic(true)
+	if err := b.Marshal(m); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,130 @@
+package tfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+	cb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// readConfigUpdate reads a channel artifact the way the SDK does when saving
+// the channel.
+func readConfigUpdate(t *testing.T, txPath string) *cb.ConfigUpdate {
+	data, err := ioutil.ReadFile(txPath)
+	require.NoError(t, err)
+	updateBytes, err := resource.ExtractChannelConfig(data)
+	require.NoError(t, err, "expected the SDK to read %s", txPath)
+	update := &cb.ConfigUpdate{}
+	require.NoError(t, proto.Unmarshal(updateBytes, update))
+	return update
+}
+
+// gameChannelConfigtx renders the bundled configtx.yaml of the orgs of the
+// default network into the dir.
+func gameChannelConfigtx(t *testing.T, dir string, orgNames ...string) (string, []NetworkOrg) {
+	n := DefaultNetwork()
+	orgs, err := n.channelOrgs(orgNames)
+	require.NoError(t, err)
+	configtxPath := filepath.Join(dir, "configtx.yaml")
+	require.NoError(t, executeTemplate("", configtxPath, "configtx.yaml_template", configtxData{orgs, n}))
+	return configtxPath, orgs
+}
+
+func TestChannelProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channel")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configtxPath, _ := gameChannelConfigtx(t, dir, Player1, Player2)
+	profile, err := loadChannelProfile(configtxPath, gameChannelProfile)
+	require.NoError(t, err)
+	require.Equal(t, channelProfile{
+		Consortium:   "TFCConsortium",
+		Capabilities: []string{"V1_3"},
+		Policies: map[string]*cb.ImplicitMetaPolicy{
+			readersPolicyKey: {SubPolicy: readersPolicyKey, Rule: cb.ImplicitMetaPolicy_ANY},
+			writersPolicyKey: {SubPolicy: writersPolicyKey, Rule: cb.ImplicitMetaPolicy_ANY},
+			adminsPolicyKey:  {SubPolicy: adminsPolicyKey, Rule: cb.ImplicitMetaPolicy_MAJORITY},
+		},
+	}, profile)
+
+	_, err = loadChannelProfile(configtxPath, "TFCMissing")
+	require.Error(t, err, "expected a missing profile to be rejected")
+
+	profiles := map[string]string{
+		"no consortium":    "Profiles: {TFCChannel: {Application: {}}}",
+		"no application":   "Profiles: {TFCChannel: {Consortium: C}}",
+		"signature policy": "Profiles: {TFCChannel: {Consortium: C, Application: {Policies: {Admins: {Type: Signature, Rule: \"OR('A.admin')\"}}}}}",
+		"unknown rule":     "Profiles: {TFCChannel: {Consortium: C, Application: {Policies: {Admins: {Type: ImplicitMeta, Rule: SOME Admins}}}}}",
+	}
+	for name, configtx := range profiles {
+		_, err := parseChannelProfile([]byte(configtx), gameChannelProfile)
+		require.Error(t, err, "expected a profile with %s to be rejected", name)
+	}
+}
+
+// The golden artifacts of testdata/channel were generated by the encoder of
+// configtxgen 1.4.1, from the TFCChannel profile of the bundled configtx.yaml
+// rendered for the orgs below. The decoded config updates are compared, as
+// configtxgen stamps the channel creation with the time it ran, and does not
+// sort the maps it marshals.
+func TestChannelArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channel")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configtxPath, orgs := gameChannelConfigtx(t, dir, Player1, Player2, Player3)
+	profile, err := loadChannelProfile(configtxPath, gameChannelProfile)
+	require.NoError(t, err)
+	written, err := writeChannelArtifacts(dir, "tfcgame", profile, orgs)
+	require.NoError(t, err)
+
+	files := []string{"tfcgame.tx", "Player1anchors.tx", "Player2anchors.tx", "Player3anchors.tx"}
+	require.Len(t, written, len(files))
+	for i, f := range files {
+		require.Equal(t, filepath.Join(dir, f), written[i])
+		golden := readConfigUpdate(t, filepath.Join("testdata", "channel", f))
+		update := readConfigUpdate(t, filepath.Join(dir, f))
+		require.True(t, proto.Equal(golden, update), "%s differs from the configtxgen artifact:\n%s\nexpected:\n%s",
+			f, proto.MarshalTextString(update), proto.MarshalTextString(golden))
+	}
+
+	update := readConfigUpdate(t, filepath.Join(dir, "tfcgame.tx"))
+	require.Equal(t, "tfcgame", update.ChannelId)
+	consortium := &cb.Consortium{}
+	require.NoError(t, proto.Unmarshal(update.WriteSet.Values[consortiumKey].Value, consortium))
+	require.Equal(t, "TFCConsortium", consortium.Name)
+
+	app := update.WriteSet.Groups[applicationGroupKey]
+	require.Equal(t, uint64(1), app.Version)
+	require.Len(t, app.Groups, 3)
+	require.Contains(t, app.Groups, Player3)
+	require.Len(t, update.ReadSet.Groups[applicationGroupKey].Groups, 3)
+	capabilities := &cb.Capabilities{}
+	require.NoError(t, proto.Unmarshal(app.Values[capabilitiesKey].Value, capabilities))
+	require.Contains(t, capabilities.Capabilities, "V1_3")
+	admins := &cb.ImplicitMetaPolicy{}
+	require.NoError(t, proto.Unmarshal(app.Policies[adminsPolicyKey].Policy.Value, admins))
+	require.Equal(t, cb.ImplicitMetaPolicy_MAJORITY, admins.Rule)
+
+	update = readConfigUpdate(t, filepath.Join(dir, "Player2anchors.tx"))
+	org := update.WriteSet.Groups[applicationGroupKey].Groups[Player2]
+	require.Equal(t, uint64(1), org.Version)
+	anchors := &pb.AnchorPeers{}
+	require.NoError(t, proto.Unmarshal(org.Values[anchorPeersKey].Value, anchors))
+	require.Equal(t, []*pb.AnchorPeer{{Host: "peer0.player2.tfc.com", Port: 7051}}, anchors.AnchorPeers)
+	require.NotContains(t, update.ReadSet.Groups[applicationGroupKey].Groups[Player2].Values, anchorPeersKey)
+}
+
+func TestChannelArtifactsRejectInvalid(t *testing.T) {
+	_, err := channelCreateTx("tfcgame", channelProfile{}, nil)
+	require.Error(t, err, "expected a channel without orgs to be rejected")
+	_, err = anchorPeersTx("tfcgame", NetworkOrg{Name: "Org1"})
+	require.Error(t, err, "expected an org without peers to be rejected")
+}
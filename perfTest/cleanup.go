@@ -0,0 +1,275 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContainerRuntime runs the chaincode containers of the peers.
+type ContainerRuntime interface {
+	// RemoveContainers stops and removes the containers with the names.
+	// Names of containers which do not exist are ignored.
+	RemoveContainers(ctx context.Context, names []string) error
+}
+
+// NoContainerRuntime leaves the chaincode containers on the peers.
+const NoContainerRuntime = "none"
+
+// containerRuntimes maps the runtime names to the runtimes.
+var containerRuntimes = map[string]ContainerRuntime{
+	"docker": dockerRuntime{},
+}
+
+// RegisterContainerRuntime makes the runtime available to the Cleanup under
+// the name.
+func RegisterContainerRuntime(name string, runtime ContainerRuntime) {
+	containerRuntimes[name] = runtime
+}
+
+// Cleanup decides what is removed from the network once a game is over.
+// Fabric can neither delete channels nor uninstall chaincode, and the game
+// chaincodes are shared by all the channels of a peer, so only the
+// containers of the alliance chaincodes, which are specific to a game, are
+// removed.
+type Cleanup struct {
+	// Runtime is the runtime of the chaincode containers, such as docker. It
+	// defaults to none, which leaves the containers on the peers.
+	Runtime string `yaml:"runtime"`
+	// NetworkID prefixes the names of the chaincode containers, as the
+	// CORE_PEER_NETWORKID of the peers does. It defaults to dev.
+	NetworkID string `yaml:"networkID"`
+	// Timeout bounds the cleanup of a game. It defaults to one minute.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// DefaultCleanup leaves the chaincode containers on the peers.
+func DefaultCleanup() Cleanup {
+	return Cleanup{Runtime: NoContainerRuntime, NetworkID: "dev", Timeout: time.Minute}
+}
+
+// Validate checks that the runtime is known.
+func (c Cleanup) Validate() error {
+	if _, ok := containerRuntimes[c.Runtime]; !ok && c.Runtime != NoContainerRuntime {
+		return fmt.Errorf("unknown container runtime %q", c.Runtime)
+	}
+	if c.NetworkID == "" {
+		return fmt.Errorf("cleanup needs the network id of the peers")
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("cleanup needs a positive timeout, got %s", c.Timeout)
+	}
+	return nil
+}
+
+// chaincodeResource is a chaincode instantiated by a game.
+type chaincodeResource struct {
+	name     string
+	version  string
+	peers    []string
+	alliance bool
+}
+
+// gameResources records the channel and chaincodes created on the network by
+// a game. It is shared by the players of the game, and safe for concurrent
+// use. A nil gameResources records nothing.
+type gameResources struct {
+	lock       sync.Mutex
+	channel    string
+	chaincodes []chaincodeResource
+}
+
+func (r *gameResources) addChannel(name string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.channel = name
+}
+
+func (r *gameResources) addChaincode(cc chaincodeResource) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.chaincodes = append(r.chaincodes, cc)
+}
+
+// containerNameChars are the characters fabric replaces in container names.
+var containerNameChars = regexp.MustCompile("[^a-zA-Z0-9-_.]")
+
+// containerName is the name fabric gives to the container of the chaincode
+// on the peer.
+func containerName(networkID, peer, ccName, version string) string {
+	name := fmt.Sprintf("%s-%s-%s-%s", networkID, peer, ccName, version)
+	return containerNameChars.ReplaceAllString(name, "-")
+}
+
+// allianceContainers returns the containers of the alliance chaincodes of the
+// game.
+func (r *gameResources) allianceContainers(networkID string) []string {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names := []string{}
+	for _, cc := range r.chaincodes {
+		if !cc.alliance {
+			continue
+		}
+		for _, p := range cc.peers {
+			names = append(names, containerName(networkID, p, cc.name, cc.version))
+		}
+	}
+	return names
+}
+
+// permanent describes the resources of the game which can not be removed:
+// its channel, and the instances of the game chaincodes.
+func (r *gameResources) permanent() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	resources := []string{"channel " + r.channel}
+	for _, cc := range r.chaincodes {
+		if !cc.alliance {
+			resources = append(resources, "chaincode "+cc.name)
+		}
+	}
+	return strings.Join(resources, ", ")
+}
+
+// peersOf returns the peers of the players.
+func peersOf(players []*TFCClient) []string {
+	peers := []string{}
+	for _, p := range players {
+		peers = append(peers, p.Peers...)
+	}
+	return peers
+}
+
+// leftoverContainers are the containers which could not be removed after
+// their game, and are retried with the next cleanup.
+type leftoverContainers struct {
+	lock  sync.Mutex
+	names []string
+}
+
+func (lc *leftoverContainers) take() []string {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	names := lc.names
+	lc.names = nil
+	return names
+}
+
+func (lc *leftoverContainers) add(names []string) {
+	lc.lock.Lock()
+	defer lc.lock.Unlock()
+	lc.names = append(lc.names, names...)
+}
+
+// removeContainers removes the containers, and the leftovers of earlier
+// cleanups, with the runtime of the Cleanup. Containers which can not be
+// removed are left over for the next cleanup.
+func (cfg *RunConfig) removeContainers(names []string) error {
+	runtime, ok := containerRuntimes[cfg.Cleanup.Runtime]
+	if !ok {
+		return nil
+	}
+	names = append(cfg.leftovers.take(), names...)
+	if len(names) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Cleanup.Timeout)
+	defer cancel()
+	err := runtime.RemoveContainers(ctx, names)
+	if err != nil {
+		cfg.leftovers.add(names)
+		return err
+	}
+	return nil
+}
+
+// cleanupGame removes the alliance chaincode containers of the game of the
+// players. The cleanup is measured, and its failure is logged without
+// failing the game.
+func cleanupGame(players []*TFCClient) {
+	if len(players) == 0 {
+		return
+	}
+	p1 := players[0]
+	cfg := p1.cfg
+	names := p1.resources.allianceContainers(cfg.Cleanup.NetworkID)
+	if len(names) == 0 || cfg.Cleanup.Runtime == NoContainerRuntime {
+		return
+	}
+	log.Printf("Removing %d alliance containers of %s, leaving %s on the network",
+		len(names), p1.GameName, p1.resources.permanent())
+
+	st := time.Now()
+	err := cfg.removeContainers(names)
+	rt := time.Since(st).Seconds()
+
+	if p1.Metrics != nil {
+		orgs := []string{}
+		for _, p := range players {
+			orgs = append(orgs, p.OrgID)
+		}
+		p1.Metrics.Record(RunRecord{Time: st, Game: p1.GameName, Op: CleanupOp,
+			Org: strings.Join(orgs, ","), CC: "alliance"}, rt, err)
+	}
+	if err != nil {
+		log.Printf("Could not remove the alliance containers of %s: %s", p1.GameName, err)
+	}
+}
+
+// CleanupLeftovers removes the containers which could not be removed after
+// their games, so the next experiment starts without them.
+func (cfg *RunConfig) CleanupLeftovers() error {
+	err := cfg.removeContainers(nil)
+	if err != nil {
+		return fmt.Errorf("could not remove leftover containers: %s", err)
+	}
+	return nil
+}
+
+// dockerRuntime removes the containers with the docker CLI.
+type dockerRuntime struct{}
+
+func (dockerRuntime) RemoveContainers(ctx context.Context, names []string) error {
+	out, err := exec.CommandContext(ctx, "docker", "ps", "--all", "--format", "{{.Names}}").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not list containers: %s %s", err, out)
+	}
+	existing := map[string]bool{}
+	for _, name := range strings.Fields(string(out)) {
+		existing[name] = true
+	}
+
+	remove := []string{}
+	for _, name := range names {
+		if existing[name] {
+			remove = append(remove, name)
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	out, err = exec.CommandContext(ctx, "docker", append([]string{"rm", "--force"}, remove...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("could not remove containers: %s %s", err, out)
+	}
+	return nil
+}
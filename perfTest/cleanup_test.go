@@ -0,0 +1,100 @@
+package tfc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRuntime records the containers it removes, and fails while err is set.
+type fakeRuntime struct {
+	lock    sync.Mutex
+	err     error
+	removed []string
+}
+
+func (fr *fakeRuntime) RemoveContainers(ctx context.Context, names []string) error {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+	if fr.err != nil {
+		return fr.err
+	}
+	fr.removed = append(fr.removed, names...)
+	return nil
+}
+
+// useFakeRuntime makes the games of the config clean up through a fake
+// runtime. The returned function unregisters the runtime.
+func useFakeRuntime(cfg *RunConfig) (*fakeRuntime, func()) {
+	fr := &fakeRuntime{}
+	RegisterContainerRuntime("fake", fr)
+	cfg.Cleanup = Cleanup{Runtime: "fake", NetworkID: "dev", Timeout: time.Second}
+	return fr, func() {
+		delete(containerRuntimes, "fake")
+	}
+}
+
+func TestCleanupGame(t *testing.T) {
+	cfg := simRunConfig()
+	fr, restore := useFakeRuntime(cfg)
+	defer restore()
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "echo", Path: "sim/echo", Version: "1.0"}
+	players, err := cfg.Ledger.Connect(context.Background(), cfg, "cleanup1", []string{Player1, Player2})
+	require.NoError(t, err)
+	resources := &gameResources{}
+	for _, p := range players {
+		p.resources = resources
+	}
+	require.NoError(t, deployChaincode(context.Background(), ccReq.Path, ccReq.Name, players))
+	require.NoError(t, startGame(context.Background(), players, "cleanup1", ccReq))
+	resources.addChaincode(chaincodeResource{name: "cleanup11", version: "1.0",
+		peers: peersOf(players), alliance: true})
+	require.Equal(t, "channel cleanup1, chaincode echo", resources.permanent())
+
+	closePlayers(players)
+	require.Equal(t, []string{"dev-peer0.player1.tfc.com-cleanup11-1.0", "dev-peer0.player2.tfc.com-cleanup11-1.0"},
+		fr.removed, "expected only the alliance containers to be removed")
+}
+
+func TestCleanupLeftovers(t *testing.T) {
+	cfg := simRunConfig()
+	fr, restore := useFakeRuntime(cfg)
+	defer restore()
+
+	resources := &gameResources{}
+	resources.addChaincode(chaincodeResource{name: "game1", version: "1.0", peers: []string{"peer0"}, alliance: true})
+	players := []*TFCClient{{GameName: "game", resources: resources, Ledger: NewSimLedger(), cfg: cfg}}
+
+	fr.err = errors.New("daemon not running")
+	closePlayers(players)
+	require.Empty(t, fr.removed)
+
+	fr.err = nil
+	require.NoError(t, cfg.CleanupLeftovers())
+	require.Equal(t, []string{"dev-peer0-game1-1.0"}, fr.removed, "expected the leftovers of the failed cleanup")
+	require.NoError(t, cfg.CleanupLeftovers())
+	require.Len(t, fr.removed, 1, "expected the leftovers to be removed once")
+
+	cfg.Cleanup.Runtime = NoContainerRuntime
+	closePlayers(players)
+	require.Len(t, fr.removed, 1, "expected the containers to be left without a runtime")
+}
+
+func TestCleanupRejectsInvalid(t *testing.T) {
+	require.NoError(t, DefaultCleanup().Validate())
+	require.NoError(t, Cleanup{Runtime: "docker", NetworkID: "dev", Timeout: time.Second}.Validate())
+	cleanups := map[string]Cleanup{
+		"unknown runtime": {Runtime: "podman", NetworkID: "dev", Timeout: time.Second},
+		"no network id":   {Runtime: NoContainerRuntime, Timeout: time.Second},
+		"no timeout":      {Runtime: NoContainerRuntime, NetworkID: "dev"},
+	}
+	for name, c := range cleanups {
+		require.Error(t, c.Validate(), "expected %s to be rejected", name)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+)
+
+const grafanaHeader = "Series;Time;Value"
+
+// Kinds of Grafana exports read instead of run logs. Runtime exports, such as
+// reports/grafana_rt.csv, are the only ones holding latencies. Other exports,
+// such as the throughput of grafana_tps.csv, share their header and can not be
+// told apart by it; the throughput is read along the runtimes with -tps.
+const (
+	noGrafanaExport      = ""
+	grafanaRuntimeExport = "rt"
+)
+
+// isGrafanaExport tells if the file has the header of the Grafana exports.
+func isGrafanaExport(logPath string) (bool, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return false, fmt.Errorf("could not open %s: %s", logPath, err)
+	}
+	defer f.Close()
+
+	header, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && header == "" {
+		return false, nil
+	}
+	return strings.TrimSpace(header) == grafanaHeader, nil
+}
+
+// grafanaRow is a sample of a series exported from Grafana.
+type grafanaRow struct {
+	line   int
+	series string
+	at     time.Time
+	value  float64
+}
+
+// readGrafanaRows reads all samples of a Grafana export.
+func readGrafanaRows(exportPath string) ([]grafanaRow, error) {
+	f, err := os.Open(exportPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %s", exportPath, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comma = ';'
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse Grafana export %s: %s", exportPath, err)
+	}
+
+	samples := []grafanaRow{}
+	for i, row := range rows[1:] {
+		if len(row) != 3 {
+			return nil, fmt.Errorf("line %d of %s: expected 3 fields, got %d", i+2, exportPath, len(row))
+		}
+
+		value, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: could not parse value: %s", i+2, exportPath, err)
+		}
+		at, err := time.Parse(time.RFC3339Nano, row[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: could not parse time: %s", i+2, exportPath, err)
+		}
+		samples = append(samples, grafanaRow{line: i + 2, series: row[0], at: at, value: value})
+	}
+	return samples, nil
+}
+
+// readGrafanaExport reads a runtime series exported from Grafana. Every sample
+// becomes a record with the sampled runtime as latency. The samples are
+// averages over the scrape interval, not single transactions, so they are
+// reported apart from run logs, see summarizeSamples. Only the series named
+// after the failed label of the runtimes are read, others such as the
+// quantiles of the runtime panels are skipped. Exports without runtime series
+// are rejected.
+func readGrafanaExport(exportPath string) ([]tfc.RunRecord, error) {
+	rows, err := readGrafanaRows(exportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []tfc.RunRecord{}
+	skipped := map[string]bool{}
+	nOfRuntimes := 0
+	for _, row := range rows {
+		cc, failed, ok := parseGrafanaSeries(row.series)
+		if !ok {
+			skipped[row.series] = true
+			continue
+		}
+		nOfRuntimes++
+
+		if math.IsNaN(row.value) {
+			continue
+		}
+		records = append(records, tfc.RunRecord{
+			Time:    row.at.Add(-time.Duration(row.value * float64(time.Second))),
+			Op:      tfc.InvokeOp,
+			CC:      cc,
+			Latency: row.value,
+			Success: !failed,
+		})
+	}
+
+	if nOfRuntimes == 0 {
+		return nil, fmt.Errorf("%s has no runtime series, expected series named like \"TFC (Failed - False)\"", exportPath)
+	}
+	for series := range skipped {
+		log.Printf("Skipped the series %q of %s, it is not a runtime series", series, exportPath)
+	}
+	return records, nil
+}
+
+// readGrafanaRates reads a throughput series exported from Grafana, such as
+// reports/grafana_tps.csv, into the rate samples of each label. Its series
+// are named after the chaincode labels only, exports holding series with the
+// failed label are rejected as they are not throughput series.
+func readGrafanaRates(exportPath string) (map[string][]rateSample, error) {
+	rows, err := readGrafanaRows(exportPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := map[string][]rateSample{}
+	for _, row := range rows {
+		if _, _, ok := parseGrafanaSeries(row.series); ok {
+			return nil, fmt.Errorf("line %d of %s: %q is not a throughput series", row.line, exportPath, row.series)
+		}
+		if math.IsNaN(row.value) {
+			continue
+		}
+		label := strings.TrimSpace(row.series)
+		rates[label] = append(rates[label], rateSample{Time: row.at, TPS: row.value})
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("%s has no throughput samples", exportPath)
+	}
+	return rates, nil
+}
+
+// parseGrafanaSeries splits series names such as "TFC (Failed - True)" into
+// the chaincode label and the failed flag. It returns false for series
+// without the failed label, which are not runtime series.
+func parseGrafanaSeries(series string) (string, bool, bool) {
+	series = strings.TrimSpace(series)
+	i := strings.Index(series, "(Failed - ")
+	if i < 0 {
+		return "", false, false
+	}
+
+	failed := strings.HasPrefix(series[i:], "(Failed - True")
+	return strings.TrimSpace(series[:i]), failed, true
+}
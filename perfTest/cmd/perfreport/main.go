@@ -0,0 +1,85 @@
+// Command perfreport creates latency and throughput charts, and an HTML
+// summary, from the run logs of the performance tests. With -grafana rt, it
+// reads the runtime series exported from Grafana, such as
+// reports/grafana_rt.csv, instead. Those are samples rather than transactions,
+// so their throughput is only reported when read from the throughput export
+// given with -tps, such as reports/grafana_tps.csv.
+//
+// Usage:
+//
+//	perfreport -out reports/run1 -format svg run1.jsonl [more logs...]
+//	perfreport -out reports/rt -grafana rt -tps reports/grafana_tps.csv reports/grafana_rt.csv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+)
+
+func main() {
+	outDir := flag.String("out", "report", "directory the report is written to")
+	format := flag.String("format", "png", "image format of the charts: png or svg")
+	title := flag.String("title", "Performance report", "title of the report")
+	grafana := flag.String("grafana", noGrafanaExport, "kind of the Grafana exports read instead of run logs: rt for runtimes")
+	tpsExport := flag.String("tps", "", "Grafana throughput export read along the -grafana rt runtimes")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: perfreport [flags] runlog...")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	data := runData{Records: []tfc.RunRecord{}, Sampled: *grafana == grafanaRuntimeExport}
+	for _, logPath := range flag.Args() {
+		rs, err := readRecords(logPath, *grafana)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data.Records = append(data.Records, rs...)
+	}
+
+	if *tpsExport != "" {
+		if !data.Sampled {
+			log.Fatalf("-tps is only read along Grafana runtime exports, with -grafana %s", grafanaRuntimeExport)
+		}
+		rates, err := readGrafanaRates(*tpsExport)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data.Rates = rates
+	}
+
+	err := writeReport(*outDir, *format, *title, data)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Report written to %s", *outDir)
+}
+
+// readRecords reads a run log, or a Grafana export of the kind.
+func readRecords(logPath, grafanaKind string) ([]tfc.RunRecord, error) {
+	isExport, err := isGrafanaExport(logPath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch grafanaKind {
+	case noGrafanaExport:
+		if isExport {
+			return nil, fmt.Errorf("%s is a Grafana export, read runtime exports with -grafana %s",
+				logPath, grafanaRuntimeExport)
+		}
+		return tfc.ReadRunLog(logPath)
+	case grafanaRuntimeExport:
+		if !isExport {
+			return nil, fmt.Errorf("%s is not a Grafana export", logPath)
+		}
+		return readGrafanaExport(logPath)
+	}
+	return nil, fmt.Errorf("unknown Grafana export kind %q", grafanaKind)
+}
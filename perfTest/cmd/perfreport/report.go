@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+)
+
+// rateSample is a throughput sample of a Grafana export.
+type rateSample struct {
+	Time time.Time
+	TPS  float64
+}
+
+// runData is what a report is made of. Records read from Grafana runtime
+// exports are Sampled: they are averages over the scrape interval rather than
+// transactions. The throughput of sampled runs can only come from the Rates of
+// a Grafana throughput export, by label.
+type runData struct {
+	Records []tfc.RunRecord
+	Sampled bool
+	Rates   map[string][]rateSample
+}
+
+// labelSummary holds the statistics of all records with the same label.
+type labelSummary struct {
+	Label       string
+	Count       int
+	Failed      int
+	FailureRate float64
+	P50         float64
+	P90         float64
+	P99         float64
+	TPS         float64
+}
+
+// recordLabel groups invocations by chaincode label, and operations by their
+// kind. Open-loop steps measured from their scheduled time are grouped apart
+// from the invocations of their chaincode.
+func recordLabel(rec tfc.RunRecord) string {
+	if rec.Op == "" || rec.Op == tfc.InvokeOp {
+		return rec.CC
+	}
+	if rec.Op == tfc.ScheduledOp {
+		return rec.CC + "/scheduled"
+	}
+	return "Operations/" + rec.Op
+}
+
+func recordEnd(rec tfc.RunRecord) time.Time {
+	return rec.Time.Add(time.Duration(rec.Latency * float64(time.Second)))
+}
+
+// runSpan returns the start of the first, and the end of the last record.
+func runSpan(records []tfc.RunRecord) (time.Time, time.Time) {
+	start, end := records[0].Time, recordEnd(records[0])
+	for _, rec := range records[1:] {
+		if rec.Time.Before(start) {
+			start = rec.Time
+		}
+		if recordEnd(rec).After(end) {
+			end = recordEnd(rec)
+		}
+	}
+	return start, end
+}
+
+func groupByLabel(records []tfc.RunRecord) ([]string, map[string][]tfc.RunRecord) {
+	groups := map[string][]tfc.RunRecord{}
+	for _, rec := range records {
+		label := recordLabel(rec)
+		groups[label] = append(groups[label], rec)
+	}
+
+	labels := []string{}
+	for label := range groups {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels, groups
+}
+
+// summarize computes the latency percentiles of the successful records, the
+// failure rate, and the mean throughput over the whole run.
+func summarize(records []tfc.RunRecord) []labelSummary {
+	start, end := runSpan(records)
+	duration := end.Sub(start).Seconds()
+
+	labels, groups := groupByLabel(records)
+	summaries := []labelSummary{}
+	for _, label := range labels {
+		latencies := []float64{}
+		summary := labelSummary{Label: label, Count: len(groups[label])}
+		for _, rec := range groups[label] {
+			if !rec.Success {
+				summary.Failed++
+				continue
+			}
+			latencies = append(latencies, rec.Latency)
+		}
+
+		summary.FailureRate = float64(summary.Failed) / float64(summary.Count)
+		summary.P50, summary.P90, summary.P99 = math.NaN(), math.NaN(), math.NaN()
+		if len(latencies) > 0 {
+			sort.Float64s(latencies)
+			summary.P50 = stat.Quantile(0.5, stat.Empirical, latencies, nil)
+			summary.P90 = stat.Quantile(0.9, stat.Empirical, latencies, nil)
+			summary.P99 = stat.Quantile(0.99, stat.Empirical, latencies, nil)
+		}
+		if duration > 0 {
+			summary.TPS = float64(len(latencies)) / duration
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// summarizeSamples computes the percentiles of the successful runtime samples
+// of Grafana exports. The samples are not transactions, so their count is only
+// the number of samples, and no failures are reported. The throughput is the
+// mean of the rate samples of the label, or NaN without any.
+func summarizeSamples(records []tfc.RunRecord, rates map[string][]rateSample) []labelSummary {
+	labels, groups := groupByLabel(records)
+	for label := range rates {
+		if _, ok := groups[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+
+	summaries := []labelSummary{}
+	for _, label := range labels {
+		latencies := []float64{}
+		for _, rec := range groups[label] {
+			if rec.Success {
+				latencies = append(latencies, rec.Latency)
+			}
+		}
+
+		summary := labelSummary{Label: label, Count: len(groups[label]), FailureRate: math.NaN()}
+		summary.P50, summary.P90, summary.P99 = math.NaN(), math.NaN(), math.NaN()
+		if len(latencies) > 0 {
+			sort.Float64s(latencies)
+			summary.P50 = stat.Quantile(0.5, stat.Empirical, latencies, nil)
+			summary.P90 = stat.Quantile(0.9, stat.Empirical, latencies, nil)
+			summary.P99 = stat.Quantile(0.99, stat.Empirical, latencies, nil)
+		}
+
+		summary.TPS = math.NaN()
+		if samples := rates[label]; len(samples) > 0 {
+			tps := make([]float64, len(samples))
+			for i, sample := range samples {
+				tps[i] = sample.TPS
+			}
+			summary.TPS = stat.Mean(tps, nil)
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// tpsSeries counts the successful records completed in each second of the
+// run.
+func tpsSeries(records []tfc.RunRecord, start, end time.Time) plotter.XYs {
+	seconds := int(end.Sub(start).Seconds()) + 1
+	xys := make(plotter.XYs, seconds)
+	for i := range xys {
+		xys[i].X = float64(i)
+	}
+
+	for _, rec := range records {
+		if !rec.Success {
+			continue
+		}
+		xys[int(recordEnd(rec).Sub(start).Seconds())].Y++
+	}
+	return xys
+}
+
+// rateSeries plots the rate samples of a Grafana throughput export.
+func rateSeries(samples []rateSample, start time.Time) plotter.XYs {
+	xys := make(plotter.XYs, len(samples))
+	for i, sample := range samples {
+		xys[i].X = sample.Time.Sub(start).Seconds()
+		xys[i].Y = sample.TPS
+	}
+	return xys
+}
+
+func latencySeries(records []tfc.RunRecord, start time.Time) plotter.XYs {
+	xys := plotter.XYs{}
+	for _, rec := range records {
+		if !rec.Success {
+			continue
+		}
+		xys = append(xys, plotter.XY{X: recordEnd(rec).Sub(start).Seconds(), Y: rec.Latency})
+	}
+	return xys
+}
+
+func savePlot(title, yLabel, chartPath string, addSeries func(p *plot.Plot) error) error {
+	p, err := plot.New()
+	if err != nil {
+		return fmt.Errorf("could not create plot: %s", err)
+	}
+	p.Title.Text = title
+	p.X.Label.Text = "Time since start (s)"
+	p.Y.Label.Text = yLabel
+	p.Legend.Top = true
+
+	err = addSeries(p)
+	if err != nil {
+		return fmt.Errorf("could not plot %s: %s", title, err)
+	}
+
+	err = p.Save(10*vg.Inch, 5*vg.Inch, chartPath)
+	if err != nil {
+		return fmt.Errorf("could not save %s: %s", chartPath, err)
+	}
+	return nil
+}
+
+// writeCharts plots the latency and the throughput over time, one series per
+// label, and returns the file names of the charts. The throughput of sampled
+// runs is plotted from their rates, and left out without any.
+func writeCharts(outDir, format string, data runData) ([]string, error) {
+	start, end := runSpan(data.Records)
+	labels, groups := groupByLabel(data.Records)
+
+	latencyChart := "latency." + format
+	err := savePlot("Latency", "Latency (s)", filepath.Join(outDir, latencyChart), func(p *plot.Plot) error {
+		series := []interface{}{}
+		for _, label := range labels {
+			if xys := latencySeries(groups[label], start); len(xys) > 0 {
+				series = append(series, label, xys)
+			}
+		}
+		return plotutil.AddScatters(p, series...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Sampled && len(data.Rates) == 0 {
+		return []string{latencyChart}, nil
+	}
+
+	tpsChart := "tps." + format
+	err = savePlot("Throughput", "Transactions per second", filepath.Join(outDir, tpsChart), func(p *plot.Plot) error {
+		series := []interface{}{}
+		if data.Sampled {
+			rateLabels := []string{}
+			for label := range data.Rates {
+				rateLabels = append(rateLabels, label)
+			}
+			sort.Strings(rateLabels)
+			for _, label := range rateLabels {
+				series = append(series, label, rateSeries(data.Rates[label], start))
+			}
+			return plotutil.AddLines(p, series...)
+		}
+
+		for _, label := range labels {
+			series = append(series, label, tpsSeries(groups[label], start, end))
+		}
+		return plotutil.AddLines(p, series...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{latencyChart, tpsChart}, nil
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"seconds": func(v float64) string {
+		if math.IsNaN(v) {
+			return "-"
+		}
+		return fmt.Sprintf("%.3f", v)
+	},
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", 100*v) },
+	"rate": func(v float64) string {
+		if math.IsNaN(v) {
+			return "-"
+		}
+		return fmt.Sprintf("%.3f", v)
+	},
+}).Parse(`<!doctype html>
+<html>
+<head>
+    <title>{{.Title}}</title>
+    <meta charset="UTF-8"/>
+    <style type="text/css">
+        table { font-family: verdana,arial,sans-serif; font-size: 11px; border-collapse: collapse; }
+        th, td { border: 1px solid #666666; padding: 8px; }
+        th { background-color: #f2f2f2; }
+    </style>
+</head>
+<body>
+    <h1>{{.Title}}</h1>
+    {{- if .Sampled}}
+    <p>{{.Count}} runtime samples of Grafana exports, from {{.Start.Format "2006-01-02 15:04:05"}} to {{.End.Format "2006-01-02 15:04:05"}}.</p>
+    <p>The samples are runtimes averaged over the scrape interval, not single transactions.
+        The percentiles are taken over the samples, and no transaction counts or failure rates are reported.
+        {{- if .HasRates}} The throughput is the mean of the Grafana throughput export.
+        {{- else}} No throughput export was read, so the throughput is left out.{{end}}</p>
+    <table>
+        <tr>
+            <th>Label</th><th>Samples</th>
+            <th>p50 (s)</th><th>p90 (s)</th><th>p99 (s)</th><th>Mean TPS</th>
+        </tr>
+        {{- range .Summaries}}
+        <tr>
+            <td>{{.Label}}</td><td>{{.Count}}</td>
+            <td>{{seconds .P50}}</td><td>{{seconds .P90}}</td><td>{{seconds .P99}}</td><td>{{rate .TPS}}</td>
+        </tr>
+        {{- end}}
+    </table>
+    {{- else}}
+    <p>{{.Count}} records, from {{.Start.Format "2006-01-02 15:04:05"}} to {{.End.Format "2006-01-02 15:04:05"}}.</p>
+    <table>
+        <tr>
+            <th>Label</th><th>Count</th><th>Failed</th><th>Failure rate</th>
+            <th>p50 (s)</th><th>p90 (s)</th><th>p99 (s)</th><th>Mean TPS</th>
+        </tr>
+        {{- range .Summaries}}
+        <tr>
+            <td>{{.Label}}</td><td>{{.Count}}</td><td>{{.Failed}}</td><td>{{percent .FailureRate}}</td>
+            <td>{{seconds .P50}}</td><td>{{seconds .P90}}</td><td>{{seconds .P99}}</td><td>{{rate .TPS}}</td>
+        </tr>
+        {{- end}}
+    </table>
+    {{- end}}
+    {{- range .Charts}}
+    <p><img src="{{.}}"/></p>
+    {{- end}}
+</body>
+</html>
+`))
+
+// writeReport writes the charts and the index.html summary of the run data to
+// outDir.
+func writeReport(outDir, format, title string, data runData) error {
+	if format != "png" && format != "svg" {
+		return fmt.Errorf("unknown chart format %q, expected png or svg", format)
+	}
+	records := data.Records
+	if len(records) == 0 {
+		return fmt.Errorf("no records to report on")
+	}
+
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return fmt.Errorf("could not create report directory: %s", err)
+	}
+
+	charts, err := writeCharts(outDir, format, data)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(outDir, "index.html"))
+	if err != nil {
+		return fmt.Errorf("could not create report: %s", err)
+	}
+	defer f.Close()
+
+	summaries := summarize(records)
+	if data.Sampled {
+		summaries = summarizeSamples(records, data.Rates)
+	}
+
+	start, end := runSpan(records)
+	err = reportTemplate.Execute(f, struct {
+		Title             string
+		Count             int
+		Start, End        time.Time
+		Sampled, HasRates bool
+		Summaries         []labelSummary
+		Charts            []string
+	}{title, len(records), start, end, data.Sampled, len(data.Rates) > 0, summaries, charts})
+	if err != nil {
+		return fmt.Errorf("could not write report: %s", err)
+	}
+	return nil
+}
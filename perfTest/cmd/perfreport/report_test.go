@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords() []tfc.RunRecord {
+	start := time.Date(2019, 5, 25, 15, 58, 48, 0, time.UTC)
+	records := []tfc.RunRecord{}
+	for i := 0; i < 100; i++ {
+		records = append(records, tfc.RunRecord{
+			Time:    start.Add(time.Duration(i) * 100 * time.Millisecond),
+			Op:      tfc.InvokeOp,
+			CC:      "ttt",
+			Latency: float64(i+1) / 100,
+			Success: true,
+		})
+	}
+	records = append(records,
+		tfc.RunRecord{Time: start, Op: tfc.InvokeOp, CC: "tfc", Latency: 2, Error: "timeout"},
+		tfc.RunRecord{Time: start, Op: tfc.BootstrapOp, CC: "ttt", Latency: 9, Success: true})
+	return records
+}
+
+func TestSummarize(t *testing.T) {
+	summaries := summarize(testRecords())
+	require.Len(t, summaries, 3)
+
+	ops, tfcSummary, ttt := summaries[0], summaries[1], summaries[2]
+	require.Equal(t, "Operations/bootstrap", ops.Label)
+
+	require.Equal(t, "tfc", tfcSummary.Label)
+	require.Equal(t, 1, tfcSummary.Failed)
+	require.Equal(t, 1.0, tfcSummary.FailureRate)
+
+	require.Equal(t, "ttt", ttt.Label)
+	require.Equal(t, 100, ttt.Count)
+	require.Zero(t, ttt.FailureRate)
+	require.Equal(t, 0.5, ttt.P50)
+	require.Equal(t, 0.9, ttt.P90)
+	require.Equal(t, 0.99, ttt.P99)
+	// 100 transactions over the 10.9s between the first start and the last end
+	require.InDelta(t, 100/10.9, ttt.TPS, 1e-9)
+}
+
+func TestRecordLabels(t *testing.T) {
+	require.Equal(t, "ttt", recordLabel(tfc.RunRecord{Op: tfc.InvokeOp, CC: "ttt"}))
+	require.Equal(t, "ttt/scheduled", recordLabel(tfc.RunRecord{Op: tfc.ScheduledOp, CC: "ttt"}))
+	require.Equal(t, "Operations/alliance", recordLabel(tfc.RunRecord{Op: tfc.AllianceOp, CC: "tfc1"}))
+}
+
+func TestGrafanaExport(t *testing.T) {
+	cc, failed, ok := parseGrafanaSeries("Alliance  (Failed - False) ")
+	require.True(t, ok)
+	require.Equal(t, "Alliance", cc)
+	require.False(t, failed)
+	cc, failed, ok = parseGrafanaSeries("TFC (Failed - True)")
+	require.True(t, ok)
+	require.Equal(t, "TFC", cc)
+	require.True(t, failed)
+	_, _, ok = parseGrafanaSeries("99th Quantile")
+	require.False(t, ok, "expected quantiles not to be runtime series")
+
+	exportPath := filepath.Join("..", "..", "reports", "grafana_rt.csv")
+	isExport, err := isGrafanaExport(exportPath)
+	require.NoError(t, err)
+	require.True(t, isExport)
+
+	_, err = readRecords(exportPath, noGrafanaExport)
+	require.Error(t, err, "expected exports to need the -grafana flag")
+	_, err = readRecords(exportPath, "tps")
+	require.Error(t, err, "expected unknown export kinds to be rejected")
+
+	records, err := readRecords(exportPath, grafanaRuntimeExport)
+	require.NoError(t, err, "could not read Grafana export")
+	require.NotEmpty(t, records)
+	require.Equal(t, "Alliance", records[0].CC)
+	require.Equal(t, 1.5715708179999999, records[0].Latency)
+	for _, rec := range records {
+		require.NotEqual(t, "99th Quantile", rec.CC)
+	}
+
+	// the throughput export has the same header, but no runtimes
+	tpsPath := filepath.Join("..", "..", "reports", "grafana_tps.csv")
+	_, err = readRecords(tpsPath, grafanaRuntimeExport)
+	require.Error(t, err, "expected the throughput export to be rejected as runtimes")
+
+	rates, err := readGrafanaRates(tpsPath)
+	require.NoError(t, err, "could not read Grafana throughput export")
+	require.Len(t, rates, 3)
+	require.Equal(t, 1.0, rates["Alliance"][0].TPS)
+	_, err = readGrafanaRates(exportPath)
+	require.Error(t, err, "expected the runtime export to be rejected as throughput")
+}
+
+func TestSummarizeSamples(t *testing.T) {
+	start := time.Date(2019, 5, 25, 15, 58, 48, 0, time.UTC)
+	records := []tfc.RunRecord{
+		{Time: start, Op: tfc.InvokeOp, CC: "TFC", Latency: 1, Success: true},
+		{Time: start, Op: tfc.InvokeOp, CC: "TFC", Latency: 3, Success: true},
+		{Time: start, Op: tfc.InvokeOp, CC: "TFC", Latency: 9},
+	}
+	rates := map[string][]rateSample{
+		"TFC": {{Time: start, TPS: 1}, {Time: start.Add(2 * time.Second), TPS: 2}},
+		"TTT": {{Time: start, TPS: 4}},
+	}
+
+	summaries := summarizeSamples(records, nil)
+	require.Len(t, summaries, 1)
+	require.Equal(t, 3, summaries[0].Count)
+	require.Zero(t, summaries[0].Failed)
+	require.True(t, math.IsNaN(summaries[0].FailureRate), "expected no failure rate for samples")
+	require.Equal(t, 3.0, summaries[0].P90)
+	require.True(t, math.IsNaN(summaries[0].TPS), "expected no throughput without rates")
+
+	summaries = summarizeSamples(records, rates)
+	require.Len(t, summaries, 2)
+	require.Equal(t, 1.5, summaries[0].TPS)
+	require.Equal(t, "TTT", summaries[1].Label)
+	require.Zero(t, summaries[1].Count)
+	require.Equal(t, 4.0, summaries[1].TPS)
+}
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfreport")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, writeReport(dir, "svg", "Test run", runData{Records: testRecords()}))
+
+	for _, name := range []string{"index.html", "latency.svg", "tps.svg"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err, "expected %s to be written", name)
+		require.NotZero(t, info.Size())
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	require.Contains(t, string(index), "<td>ttt</td><td>100</td><td>0</td><td>0.0%</td>")
+	require.Contains(t, string(index), `<img src="tps.svg"/>`)
+
+	require.Error(t, writeReport(dir, "pdf", "Test run", runData{Records: testRecords()}))
+	require.Error(t, writeReport(dir, "png", "Test run", runData{}))
+}
+
+func TestWriteSampledReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfreport")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	records, err := readRecords(filepath.Join("..", "..", "reports", "grafana_rt.csv"), grafanaRuntimeExport)
+	require.NoError(t, err)
+	require.NoError(t, writeReport(dir, "svg", "Grafana run", runData{Records: records, Sampled: true}))
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	require.Contains(t, string(index), "<th>Samples</th>")
+	require.NotContains(t, string(index), "<th>Failure rate</th>")
+	require.Contains(t, string(index), "the throughput is left out")
+	_, err = os.Stat(filepath.Join(dir, "tps.svg"))
+	require.True(t, os.IsNotExist(err), "expected no throughput chart without rates")
+
+	rates, err := readGrafanaRates(filepath.Join("..", "..", "reports", "grafana_tps.csv"))
+	require.NoError(t, err)
+	require.NoError(t, writeReport(dir, "svg", "Grafana run", runData{Records: records, Sampled: true, Rates: rates}))
+
+	index, err = ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	require.NoError(t, err)
+	require.Contains(t, string(index), "mean of the Grafana throughput export")
+	require.Contains(t, string(index), `<img src="tps.svg"/>`)
+}
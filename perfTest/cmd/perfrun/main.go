@@ -0,0 +1,59 @@
+// Command perfrun runs the experiments described by a plan file, bringing the
+// network up before and down after each of them. The logs, run logs and
+// results of every run are written to a timestamped report directory.
+//
+// Relative paths of the plan, such as its outDir, are resolved from the
+// working directory. The templates of the client configs are built into
+// perfrun, and can be overridden with the network templates of the plan. An
+// interrupt aborts the running experiment, brings the network down and skips
+// the remaining experiments.
+//
+// Usage:
+//
+//	perfrun plans/default.yaml
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		names := []string{}
+		for name := range tfc.Experiments {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(os.Stderr, "usage: perfrun plan.yaml")
+		fmt.Fprintf(os.Stderr, "experiments: %v\n", names)
+		os.Exit(2)
+	}
+
+	p, err := loadPlan(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		log.Println("Interrupted, aborting the run")
+		cancel()
+	}()
+
+	reportDir, err := run(ctx, p, os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("All experiments succeeded. Results are in %s", reportDir)
+}
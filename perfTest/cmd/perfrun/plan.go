@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// plan describes a series of experiments, for example:
+//
+//	outDir: reports/runs
+//	iterations: 2
+//	experiments: [ttt, tfc, incremental]
+//	network:
+//	  dir: ~/workspace/hyperledger/strategy-chains/tfc
+//	  up: [./tfc.sh, upCC]
+//	  down: [./tfc.sh, down]
+//	  description: plans/network.yaml
+//	  templates: ~/tfc/templates
+//	  confirm: true
+//	gameTimeout: 30m
+//	stepTimeout: 2m
+//	seed: 42
+//	thinkTimes:
+//	  default: {kind: uniform, min: 100ms, max: 600ms}
+//	  players:
+//	    Org1: {kind: exponential, mean: 2s}
+//	experimentThinkTimes:
+//	  incremental:
+//	    default: {kind: constant}
+//	endorsement:
+//	  strategy: round-robin
+//	cleanup:
+//	  runtime: docker
+//	artifacts:
+//	  keep: failed
+//	  maxRuns: 5
+//	  maxAge: 168h
+//	retry:
+//	  maxAttempts: 5
+//	  retryable: [conflict, endorsement, unavailable, timeout]
+//	stagePlans:
+//	  spike:
+//	    stages:
+//	      - {name: base, games: 4, concurrency: 2, mix: [{executor: ttt, weight: 1}]}
+//	      - name: spike
+//	        duration: 5m
+//	        concurrency: 16
+//	        mix: [{executor: tfc, weight: 1}]
+//	        scheduling: {policy: least-loaded, maxBootstraps: 2}
+//	openLoad:
+//	  arrivals: poisson
+//	  games: 4
+//	  game: ttt
+//	  stages:
+//	    - {duration: 30s, rate: 5, ramp: true}
+//	    - {duration: 1m, rate: 5}
+type plan struct {
+	// OutDir holds the timestamped report directories of the runs.
+	OutDir     string `yaml:"outDir"`
+	Iterations int    `yaml:"iterations"`
+	// Experiments are the names of the experiments, or of the stage plans,
+	// run in order in every iteration.
+	Experiments []string   `yaml:"experiments"`
+	Network     networkDef `yaml:"network"`
+	// Simulate runs the games on an in-process ledger instead of the network.
+	Simulate     bool              `yaml:"simulate"`
+	MetricsAddr  string            `yaml:"metricsAddr"`
+	Metrics      tfc.MetricsConfig `yaml:"metrics"`
+	RunLogFormat string            `yaml:"runLogFormat"`
+	// GameTimeout and StepTimeout bound every game and script step. Zero
+	// disables the deadline.
+	GameTimeout time.Duration `yaml:"gameTimeout"`
+	StepTimeout time.Duration `yaml:"stepTimeout"`
+	// Seed makes the random choices of the games reproducible. A random seed
+	// is drawn if it is 0.
+	Seed int64 `yaml:"seed"`
+	// Retry is the retry policy of the script steps.
+	Retry tfc.RetryPolicy `yaml:"retry"`
+	// Endorsement picks the peers endorsing the transactions.
+	Endorsement tfc.Endorsement `yaml:"endorsement"`
+	// Artifacts decides which channel artifacts and client configs of the
+	// games are kept.
+	Artifacts tfc.ArtifactRetention `yaml:"artifacts"`
+	// Cleanup decides what is removed from the network after each game.
+	Cleanup tfc.Cleanup `yaml:"cleanup"`
+	// ThinkTimes are the think times of the players in all experiments.
+	ThinkTimes tfc.ThinkTimes `yaml:"thinkTimes"`
+	// ExperimentThinkTimes override the ThinkTimes for single experiments.
+	ExperimentThinkTimes map[string]tfc.ThinkTimes `yaml:"experimentThinkTimes"`
+	// StagePlans are experiments defined by their load stages.
+	StagePlans map[string]tfc.StagePlan `yaml:"stagePlans"`
+	// OpenLoad is the load of the openloop experiment.
+	OpenLoad tfc.OpenLoad `yaml:"openLoad"`
+
+	// gameNetwork is read from the network description.
+	gameNetwork tfc.Network
+}
+
+// experiment returns the experiment, or the stage plan, with the name.
+func (p *plan) experiment(name string) (tfc.Experiment, bool) {
+	if sp, ok := p.StagePlans[name]; ok {
+		return sp.Experiment(), true
+	}
+	experiment, ok := tfc.Experiments[name]
+	return experiment, ok
+}
+
+// thinkTimes returns the think times of the experiment. The overrides of the
+// experiment are merged into the think times of all experiments.
+func (p *plan) thinkTimes(name string) tfc.ThinkTimes {
+	override, ok := p.ExperimentThinkTimes[name]
+	if !ok {
+		return p.ThinkTimes
+	}
+
+	tts := tfc.ThinkTimes{Default: override.Default, Players: map[string]tfc.ThinkTime{}}
+	if tts.Default.Kind == "" {
+		tts.Default = p.ThinkTimes.Default
+	}
+	for org, tt := range p.ThinkTimes.Players {
+		tts.Players[org] = tt
+	}
+	for org, tt := range override.Players {
+		tts.Players[org] = tt
+	}
+	return tts
+}
+
+// runConfig returns the config the experiments of the plan run with. The
+// think times are set per experiment.
+func (p *plan) runConfig() *tfc.RunConfig {
+	cfg := tfc.DefaultRunConfig()
+	if p.Simulate {
+		cfg.UseSimLedger()
+	}
+	cfg.Network = p.gameNetwork
+	cfg.GameTimeout = p.GameTimeout
+	cfg.StepTimeout = p.StepTimeout
+	cfg.Retry = p.Retry
+	cfg.Endorsement = p.Endorsement
+	cfg.OpenLoad = p.OpenLoad
+	cfg.TemplateDir = p.Network.Templates
+	cfg.Cleanup = p.Cleanup
+	if p.Seed != 0 {
+		cfg.Seed = p.Seed
+	}
+	return cfg
+}
+
+// networkDef holds the commands bringing the network up before, and down
+// after each experiment. The commands run in Dir.
+type networkDef struct {
+	Dir  string   `yaml:"dir"`
+	Up   []string `yaml:"up"`
+	Down []string `yaml:"down"`
+	// Confirm answers yes to all the prompts of the commands.
+	Confirm bool `yaml:"confirm"`
+	// Description is the path of the network description: the orderers,
+	// orgs, identities and crypto material of the network. It defaults to the
+	// five players of the tfc network.
+	Description string `yaml:"description"`
+	// Templates holds the templates of the client configs and the configtx
+	// overriding the bundled ones.
+	Templates string `yaml:"templates"`
+}
+
+// loadPlan reads the plan file, and fills in the defaults.
+func loadPlan(planPath string) (*plan, error) {
+	data, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read plan: %s", err)
+	}
+
+	defaults := tfc.DefaultRunConfig()
+	p := &plan{
+		OutDir:       "reports/runs",
+		Iterations:   1,
+		MetricsAddr:  ":9009",
+		Metrics:      tfc.DefaultMetricsConfig(),
+		RunLogFormat: "jsonl",
+		GameTimeout:  defaults.GameTimeout,
+		StepTimeout:  defaults.StepTimeout,
+		Retry:        defaults.Retry,
+		ThinkTimes:   defaults.ThinkTimes,
+		OpenLoad:     defaults.OpenLoad,
+		Artifacts:    tfc.DefaultArtifactRetention(),
+		Cleanup:      defaults.Cleanup,
+	}
+	err = yaml.UnmarshalStrict(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse plan %s: %s", planPath, err)
+	}
+
+	p.gameNetwork = tfc.DefaultNetwork()
+	if p.Network.Description != "" {
+		descPath, err := expandHome(p.Network.Description)
+		if err != nil {
+			return nil, err
+		}
+		p.gameNetwork, err = tfc.LoadNetwork(descPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.Network.Templates != "" {
+		p.Network.Templates, err = expandHome(p.Network.Templates)
+		if err != nil {
+			return nil, err
+		}
+		err = tfc.CheckTemplates(p.Network.Templates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Iterations < 1 {
+		return nil, fmt.Errorf("plan needs at least one iteration, got %d", p.Iterations)
+	}
+	if len(p.Experiments) == 0 {
+		return nil, fmt.Errorf("plan has no experiments")
+	}
+	for name, sp := range p.StagePlans {
+		if _, ok := tfc.Experiments[name]; ok {
+			return nil, fmt.Errorf("stage plan %s hides the experiment of the same name", name)
+		}
+		if err := sp.Validate(p.gameNetwork); err != nil {
+			return nil, fmt.Errorf("stage plan %s: %s", name, err)
+		}
+	}
+	for _, name := range p.Experiments {
+		if _, ok := p.experiment(name); !ok {
+			return nil, fmt.Errorf("unknown experiment %q", name)
+		}
+	}
+	if p.RunLogFormat != "csv" && p.RunLogFormat != "jsonl" {
+		return nil, fmt.Errorf("unknown run log format %q, expected csv or jsonl", p.RunLogFormat)
+	}
+	if p.GameTimeout < 0 || p.StepTimeout < 0 {
+		return nil, fmt.Errorf("timeouts can not be negative")
+	}
+	if err := p.Retry.Validate(); err != nil {
+		return nil, err
+	}
+	if err := p.Endorsement.Validate(); err != nil {
+		return nil, err
+	}
+	p.Artifacts.Root, err = expandHome(p.Artifacts.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Artifacts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := p.Cleanup.Validate(); err != nil {
+		return nil, err
+	}
+	if err := p.ThinkTimes.Validate(); err != nil {
+		return nil, err
+	}
+	for name := range p.ExperimentThinkTimes {
+		if _, ok := p.experiment(name); !ok {
+			return nil, fmt.Errorf("think times given for unknown experiment %q", name)
+		}
+		if err := p.thinkTimes(name).Validate(); err != nil {
+			return nil, fmt.Errorf("think times of %s: %s", name, err)
+		}
+	}
+	if err := p.OpenLoad.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := p.Metrics.Buckets.Layout(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+)
+
+// runResult is the outcome of one experiment run.
+type runResult struct {
+	Experiment string    `json:"experiment"`
+	Iteration  int       `json:"iteration"`
+	Start      time.Time `json:"start"`
+	Duration   float64   `json:"duration"`
+	Seed       int64     `json:"seed"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// run executes all experiments of the plan, and returns the report directory.
+// Failed experiments are recorded and the next ones still run, but failing
+// network commands abort the whole run. Cancelling ctx aborts the running
+// experiment, and skips the remaining ones.
+func run(ctx context.Context, p *plan, planPath string) (string, error) {
+	reportDir := filepath.Join(p.OutDir, time.Now().Format("20060102T150405"))
+	err := os.MkdirAll(reportDir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("could not create report directory: %s", err)
+	}
+
+	planData, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		return "", fmt.Errorf("could not read plan: %s", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(reportDir, "plan.yaml"), planData, 0644)
+	if err != nil {
+		return "", fmt.Errorf("could not copy plan: %s", err)
+	}
+
+	cfg := p.runConfig()
+	err = cfg.StartArtifactRun(p.Artifacts, filepath.Base(reportDir))
+	if err != nil {
+		return "", err
+	}
+
+	ms, err := tfc.NewMetricsServer(p.MetricsAddr, p.Metrics)
+	if err != nil {
+		return "", err
+	}
+	err = ms.Start()
+	if err != nil {
+		return "", err
+	}
+	defer ms.Shutdown()
+
+	results := []runResult{}
+	for it := 1; it <= p.Iterations; it++ {
+		for _, name := range p.Experiments {
+			if ctx.Err() != nil {
+				writeResults(reportDir, results)
+				return reportDir, fmt.Errorf("run interrupted before %s-%d. Results are in %s",
+					name, it, reportDir)
+			}
+			result, err := runExperiment(ctx, p, cfg, reportDir, name, it, ms.Metrics())
+			if err != nil {
+				writeResults(reportDir, results)
+				return reportDir, err
+			}
+			results = append(results, result)
+		}
+	}
+
+	err = writeResults(reportDir, results)
+	if err != nil {
+		return reportDir, err
+	}
+
+	failed := []string{}
+	for _, r := range results {
+		if r.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s-%d", r.Experiment, r.Iteration))
+		}
+	}
+	if len(failed) > 0 {
+		return reportDir, fmt.Errorf("experiments failed: %s. Results are in %s",
+			strings.Join(failed, ", "), reportDir)
+	}
+	return reportDir, nil
+}
+
+// runExperiment runs one iteration of the experiment between bringing the
+// network up and down, with the think times of the experiment. The experiment
+// logs and run log are written to the report directory. It only returns an
+// error if the network commands fail.
+func runExperiment(ctx context.Context, p *plan, cfg *tfc.RunConfig, reportDir, name string, it int, metrics *tfc.PlayerMetrics) (runResult, error) {
+	runID := fmt.Sprintf("%s-%d", name, it)
+	result := runResult{Experiment: name, Iteration: it, Seed: cfg.Seed}
+
+	logFile, err := os.Create(filepath.Join(reportDir, runID+".log"))
+	if err != nil {
+		return result, fmt.Errorf("could not create experiment log: %s", err)
+	}
+	defer logFile.Close()
+	log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	defer log.SetOutput(os.Stderr)
+
+	runLog, err := tfc.NewRunLog(filepath.Join(reportDir, runID+"."+p.RunLogFormat))
+	if err != nil {
+		return result, err
+	}
+	defer runLog.Close()
+	metrics.RunLog = runLog
+	defer func() { metrics.RunLog = nil }()
+
+	log.Printf("[%s] Bringing the network up", runID)
+	err = runNetworkCommand(p.Network, p.Network.Up, logFile)
+	if err != nil {
+		log.Printf("[%s] Could not bring the network up: %s", runID, err)
+		// The network may be partially up
+		runNetworkCommand(p.Network, p.Network.Down, logFile)
+		return result, fmt.Errorf("could not bring the network up for %s: %s", runID, err)
+	}
+
+	expCfg := *cfg
+	expCfg.ThinkTimes = p.thinkTimes(name)
+	log.Printf("[%s] Running the experiment with seed %d", runID, cfg.Seed)
+	result.Start = time.Now()
+	// Game names must be lower case, to be valid channel names
+	experiment, _ := p.experiment(name)
+	err = experiment(ctx, &expCfg, strings.ToLower(strings.Replace(runID, "-", "", -1)), metrics)
+	result.Duration = time.Since(result.Start).Seconds()
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("[%s] Experiment failed after %.1fs: %s", runID, result.Duration, err)
+	} else {
+		log.Printf("[%s] Experiment finished after %.1fs", runID, result.Duration)
+	}
+
+	err = cfg.CleanupLeftovers()
+	if err != nil {
+		log.Printf("[%s] %s", runID, err)
+	}
+
+	log.Printf("[%s] Bringing the network down", runID)
+	err = runNetworkCommand(p.Network, p.Network.Down, logFile)
+	if err != nil {
+		return result, fmt.Errorf("could not bring the network down after %s: %s", runID, err)
+	}
+
+	return result, nil
+}
+
+// runNetworkCommand runs the command in the network directory, writing its
+// output to out. Empty commands are skipped.
+func runNetworkCommand(network networkDef, command []string, out io.Writer) error {
+	if len(command) == 0 {
+		return nil
+	}
+
+	dir, err := expandHome(network.Dir)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if network.Confirm {
+		cmd.Stdin = &yesReader{}
+	}
+
+	err = cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return fmt.Errorf("%s exited with %s", strings.Join(command, " "), exitErr.ProcessState)
+	}
+	if err != nil {
+		return fmt.Errorf("could not run %s: %s", strings.Join(command, " "), err)
+	}
+	return nil
+}
+
+func expandHome(dir string) (string, error) {
+	if dir != "~" && !strings.HasPrefix(dir, "~/") {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not expand %s: %s", dir, err)
+	}
+	return filepath.Join(home, dir[1:]), nil
+}
+
+// yesReader answers y to every prompt, like piping yes into a command.
+type yesReader struct {
+	n int
+}
+
+func (yr *yesReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = "y\n"[yr.n%2]
+		yr.n++
+	}
+	return len(b), nil
+}
+
+func writeResults(reportDir string, results []runResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal results: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(reportDir, "results.json"), data, 0644)
+	if err != nil {
+		return fmt.Errorf("could not write results: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tfc "github.com/stefanprisca/strategy-client/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func writePlan(t *testing.T, dir, content string) string {
+	planPath := filepath.Join(dir, "plan.yaml")
+	require.NoError(t, ioutil.WriteFile(planPath, []byte(content), 0644))
+	return planPath
+}
+
+func TestRunSimulated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	planPath := writePlan(t, dir, `
+outDir: `+filepath.Join(dir, "runs")+`
+artifacts: {root: `+filepath.Join(dir, "artifacts")+`}
+experiments: [ttt]
+simulate: true
+metricsAddr: 127.0.0.1:0
+seed: 42
+thinkTimes:
+  default: {kind: constant}
+network:
+  dir: `+dir+`
+  up: [sh, -c, "read answer && echo up-$answer > network"]
+  down: [rm, network]
+  confirm: true
+`)
+	p, err := loadPlan(planPath)
+	require.NoError(t, err, "could not load plan")
+
+	reportDir, err := run(context.Background(), p, planPath)
+	require.NoError(t, err, "expected the experiments to succeed")
+
+	_, err = os.Stat(filepath.Join(dir, "network"))
+	require.True(t, os.IsNotExist(err), "expected the network to be down")
+
+	data, err := ioutil.ReadFile(filepath.Join(reportDir, "results.json"))
+	require.NoError(t, err)
+	results := []runResult{}
+	require.NoError(t, json.Unmarshal(data, &results))
+	require.Len(t, results, 1)
+	require.Equal(t, "ttt", results[0].Experiment)
+	require.Empty(t, results[0].Error)
+	require.Equal(t, int64(42), results[0].Seed, "expected the seed to be recorded")
+
+	records, err := tfc.ReadRunLog(filepath.Join(reportDir, "ttt-1.jsonl"))
+	require.NoError(t, err, "could not read the run log")
+	require.Len(t, records, 8)
+
+	for _, name := range []string{"plan.yaml", "ttt-1.log"} {
+		_, err = os.Stat(filepath.Join(reportDir, name))
+		require.NoError(t, err, "expected %s in the report", name)
+	}
+}
+
+func TestRunChecksExitCodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	planPath := writePlan(t, dir, `
+outDir: `+filepath.Join(dir, "runs")+`
+artifacts: {root: `+filepath.Join(dir, "artifacts")+`}
+experiments: [ttt, tfc]
+simulate: true
+metricsAddr: 127.0.0.1:0
+network:
+  up: [sh, -c, "exit 3"]
+`)
+	p, err := loadPlan(planPath)
+	require.NoError(t, err, "could not load plan")
+
+	_, err = run(context.Background(), p, planPath)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exit status 3")
+}
+
+func TestRunInterrupted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	planPath := writePlan(t, dir, `
+outDir: `+filepath.Join(dir, "runs")+`
+artifacts: {root: `+filepath.Join(dir, "artifacts")+`}
+experiments: [ttt]
+simulate: true
+metricsAddr: 127.0.0.1:0
+gameTimeout: 1m
+stepTimeout: 10s
+retry: {maxAttempts: 3}
+network:
+  dir: `+dir+`
+  up: [touch, network]
+`)
+	p, err := loadPlan(planPath)
+	require.NoError(t, err, "could not load plan")
+	require.Equal(t, time.Minute, p.GameTimeout)
+	require.Equal(t, 10*time.Second, p.StepTimeout)
+	expectedRetry := tfc.DefaultRetryPolicy()
+	expectedRetry.MaxAttempts = 3
+	require.Equal(t, expectedRetry, p.Retry)
+	cfg := p.runConfig()
+	require.Equal(t, time.Minute, cfg.GameTimeout)
+	require.Equal(t, 10*time.Second, cfg.StepTimeout)
+	require.Equal(t, expectedRetry, cfg.Retry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = run(ctx, p, planPath)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "interrupted")
+
+	_, err = os.Stat(filepath.Join(dir, "network"))
+	require.True(t, os.IsNotExist(err), "expected the network to stay down")
+}
+
+func TestPlanThinkTimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := loadPlan(writePlan(t, dir, `
+experiments: [ttt, tfc, incremental]
+thinkTimes:
+  players:
+    Org1: {kind: constant, value: 1s}
+experimentThinkTimes:
+  tfc:
+    players:
+      Org2: {kind: constant, value: 2s}
+  incremental:
+    default: {kind: constant}
+`))
+	require.NoError(t, err, "could not load plan")
+
+	defaults := tfc.DefaultThinkTimes().Default
+	constant := func(d time.Duration) tfc.ThinkTime { return tfc.ThinkTime{Kind: "constant", Value: d} }
+
+	ttt := p.thinkTimes("ttt")
+	require.Equal(t, defaults, ttt.Default)
+	require.Equal(t, map[string]tfc.ThinkTime{"Org1": constant(time.Second)}, ttt.Players)
+
+	tfcTimes := p.thinkTimes("tfc")
+	require.Equal(t, defaults, tfcTimes.Default, "expected the default of all experiments")
+	require.Equal(t, map[string]tfc.ThinkTime{"Org1": constant(time.Second), "Org2": constant(2 * time.Second)},
+		tfcTimes.Players)
+
+	require.Equal(t, constant(0), p.thinkTimes("incremental").Default)
+}
+
+func TestPlanStagePlans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := loadPlan(writePlan(t, dir, `
+experiments: [warm, ttt]
+stagePlans:
+  warm:
+    stages:
+      - {name: warmup, games: 2, concurrency: 1, mix: [{executor: ttt, weight: 1}]}
+experimentThinkTimes:
+  warm:
+    default: {kind: constant}
+`))
+	require.NoError(t, err, "could not load plan")
+
+	for _, name := range []string{"warm", "ttt", "spike"} {
+		_, ok := p.experiment(name)
+		require.True(t, ok, "expected experiment %s", name)
+	}
+	_, ok := p.experiment("cold")
+	require.False(t, ok)
+}
+
+func TestPlanNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := loadPlan(writePlan(t, dir, "experiments: [ttt]"))
+	require.NoError(t, err, "could not load plan")
+	require.Equal(t, tfc.DefaultNetwork(), p.gameNetwork)
+
+	networkPath := filepath.Join(dir, "network.yaml")
+	require.NoError(t, ioutil.WriteFile(networkPath,
+		[]byte("orgs: [{name: Org1}, {name: Org2}, {name: Org3}, {name: Org4}]"), 0644))
+	p, err = loadPlan(writePlan(t, dir, "experiments: [ttt]\nnetwork: {description: "+networkPath+"}"))
+	require.NoError(t, err, "could not load plan")
+	require.Len(t, p.gameNetwork.Orgs, 4)
+	require.Equal(t, []string{"Org1", "Org2", "Org3"}, p.gameNetwork.OrgSets[0])
+
+	templateDir := filepath.Join(dir, "templates")
+	require.NoError(t, os.Mkdir(templateDir, 0755))
+	p, err = loadPlan(writePlan(t, dir, "experiments: [ttt]\nnetwork: {templates: "+templateDir+"}"))
+	require.NoError(t, err, "could not load plan")
+	require.Equal(t, templateDir, p.Network.Templates)
+}
+
+func TestLoadPlanRejectsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "perfrun")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plans := map[string]string{
+		"no experiments":      "iterations: 1",
+		"unknown experiment":  "experiments: [chess]",
+		"no iterations":       "experiments: [ttt]\niterations: 0",
+		"unknown format":      "experiments: [ttt]\nrunLogFormat: xml",
+		"unknown field":       "experiments: [ttt]\nnetwrok: {}",
+		"negative timeout":    "experiments: [ttt]\nstepTimeout: -1s",
+		"unknown think time":  "experiments: [ttt]\nthinkTimes: {default: {kind: sometimes}}",
+		"unknown think exp":   "experiments: [ttt]\nexperimentThinkTimes: {chess: {}}",
+		"unknown error":       "experiments: [ttt]\nretry: {retryable: [gremlins]}",
+		"unknown arrivals":    "experiments: [openloop]\nopenLoad: {arrivals: bursty}",
+		"hidden experiment":   "experiments: [ttt]\nstagePlans: {ttt: {stages: [{name: a, games: 1, concurrency: 1, mix: [{executor: ttt, weight: 1}]}]}}",
+		"invalid stages":      "experiments: [warm]\nstagePlans: {warm: {stages: [{name: a, games: 1}]}}",
+		"exclusive open load": "experiments: [openloop]\nopenLoad: {scheduling: {policy: exclusive}}",
+		"missing network":     "experiments: [ttt]\nnetwork: {description: missing.yaml}",
+		"unknown endorsement": "experiments: [ttt]\nendorsement: {strategy: fastest}",
+		"missing templates":   "experiments: [ttt]\nnetwork: {templates: missing}",
+		"unknown artifacts":   "experiments: [ttt]\nartifacts: {keep: some}",
+		"negative max runs":   "experiments: [ttt]\nartifacts: {maxRuns: -1}",
+		"unknown runtime":     "experiments: [ttt]\ncleanup: {runtime: podman}",
+	}
+	for name, content := range plans {
+		_, err := loadPlan(writePlan(t, dir, content))
+		require.Error(t, err, "expected %s to be rejected", name)
+	}
+}
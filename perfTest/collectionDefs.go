@@ -55,7 +55,7 @@ func genStaticColConfig(p1, p2 *TFCClient) (*common.CollectionConfig, error) {
 	}
 
 	colConfig := &common.CollectionConfig{
-		Payload: &common.CollectionConfig_StaticCollectionConfig{stCol},
+		Payload: &common.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: stCol},
 	}
 
 	return colConfig, nil
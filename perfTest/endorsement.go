@@ -0,0 +1,122 @@
+package tfc
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Endorsement strategies.
+const (
+	AllEndorsers          = "all"
+	RandomEndorsers       = "random"
+	RoundRobinEndorsers   = "round-robin"
+	LeastLatencyEndorsers = "least-latency"
+)
+
+// Endorsement decides which peers endorse the transactions of a game.
+// Strategy is one of:
+//   - all: every peer of every org of the game
+//   - random: a peer of each org, picked at random
+//   - round-robin: a peer of each org, in turn
+//   - least-latency: the peer of each org with the lowest endorsement
+//     latency in the game so far, trying every peer at least once
+//
+// An empty strategy leaves the choice to the selection service of the SDK.
+type Endorsement struct {
+	Strategy string `yaml:"strategy"`
+}
+
+// Validate checks the strategy.
+func (e Endorsement) Validate() error {
+	switch e.Strategy {
+	case "", AllEndorsers, RandomEndorsers, RoundRobinEndorsers, LeastLatencyEndorsers:
+		return nil
+	}
+	return fmt.Errorf("unknown endorsement strategy %q", e.Strategy)
+}
+
+// endorserSelector picks the endorsing peers of the transactions of a game.
+// It is shared by the players of the game, and safe for concurrent use.
+type endorserSelector struct {
+	strategy string
+	orgs     []NetworkOrg
+
+	lock sync.Mutex
+	rnd  *rand.Rand
+	next map[string]int
+	// latency is the smoothed endorsement latency of each peer
+	latency map[string]time.Duration
+}
+
+func newEndorserSelector(endorsement Endorsement, orgs []NetworkOrg, rnd *rand.Rand) *endorserSelector {
+	return &endorserSelector{
+		strategy: endorsement.Strategy,
+		orgs:     orgs,
+		rnd:      rnd,
+		next:     make(map[string]int),
+		latency:  make(map[string]time.Duration),
+	}
+}
+
+// targets returns the peers endorsing the next transaction. It returns none
+// if the SDK picks them.
+func (s *endorserSelector) targets() []string {
+	if s == nil || s.strategy == "" {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	peers := []string{}
+	for _, o := range s.orgs {
+		hosts := o.peerHosts()
+		switch s.strategy {
+		case AllEndorsers:
+			peers = append(peers, hosts...)
+		case RandomEndorsers:
+			peers = append(peers, hosts[s.rnd.Intn(len(hosts))])
+		case RoundRobinEndorsers:
+			peers = append(peers, hosts[s.next[o.Name]%len(hosts)])
+			s.next[o.Name]++
+		case LeastLatencyEndorsers:
+			best := ""
+			for _, h := range hosts {
+				l, ok := s.latency[h]
+				if !ok {
+					// peers which never endorsed are tried first
+					best = h
+					break
+				}
+				if best == "" || l < s.latency[best] {
+					best = h
+				}
+			}
+			peers = append(peers, best)
+		}
+	}
+	return peers
+}
+
+// observe records the endorsement latency of a transaction. The SDK only
+// times the endorsement as a whole, so every endorsing peer is attributed the
+// latency of the slowest one.
+func (s *endorserSelector) observe(peers []string, d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, p := range peers {
+		l, ok := s.latency[p]
+		if !ok {
+			s.latency[p] = d
+			continue
+		}
+		s.latency[p] = l + (d-l)/5
+	}
+}
@@ -0,0 +1,66 @@
+package tfc
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var endorsementOrgs = []NetworkOrg{
+	{Name: "A", Peers: []NetworkPeer{{Host: "a0"}, {Host: "a1"}, {Host: "a2"}}},
+	{Name: "B", Peers: []NetworkPeer{{Host: "b0"}}},
+}
+
+func endorsers(strategy string) *endorserSelector {
+	return newEndorserSelector(Endorsement{Strategy: strategy}, endorsementOrgs, rand.New(rand.NewSource(1)))
+}
+
+func TestEndorsementStrategies(t *testing.T) {
+	require.Nil(t, endorsers("").targets(), "expected the SDK to pick the endorsers")
+	require.Equal(t, []string{"a0", "a1", "a2", "b0"}, endorsers(AllEndorsers).targets())
+
+	rr := endorsers(RoundRobinEndorsers)
+	for _, a := range []string{"a0", "a1", "a2", "a0"} {
+		require.Equal(t, []string{a, "b0"}, rr.targets())
+	}
+
+	random := func() [][]string {
+		s, picked := endorsers(RandomEndorsers), [][]string{}
+		for i := 0; i < 10; i++ {
+			picked = append(picked, s.targets())
+		}
+		return picked
+	}
+	require.Equal(t, random(), random(), "expected the same endorsers from the same seed")
+}
+
+func TestLeastLatencyEndorsers(t *testing.T) {
+	s := endorsers(LeastLatencyEndorsers)
+
+	// every peer endorses once before the latencies are compared
+	latencies := map[string]time.Duration{"a0": 30 * time.Millisecond, "a1": 10 * time.Millisecond, "a2": 20 * time.Millisecond}
+	for _, a := range []string{"a0", "a1", "a2"} {
+		targets := s.targets()
+		require.Equal(t, []string{a, "b0"}, targets)
+		s.observe(targets[:1], latencies[a])
+	}
+	require.Equal(t, []string{"a1", "b0"}, s.targets())
+
+	// a slower endorsement moves a1 behind a2
+	for i := 0; i < 5; i++ {
+		s.observe([]string{"a1"}, 100*time.Millisecond)
+	}
+	require.Equal(t, []string{"a2", "b0"}, s.targets())
+
+	var none *endorserSelector
+	require.Nil(t, none.targets())
+	none.observe([]string{"a0"}, time.Second)
+}
+
+func TestEndorsementRejectsInvalid(t *testing.T) {
+	require.NoError(t, Endorsement{}.Validate())
+	require.NoError(t, Endorsement{Strategy: LeastLatencyEndorsers}.Validate())
+	require.Error(t, Endorsement{Strategy: "fastest"}.Validate())
+}
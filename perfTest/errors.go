@@ -0,0 +1,62 @@
+package tfc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GamePhase is the part of a game in which it failed.
+type GamePhase string
+
+// Phases of a game.
+const (
+	BootstrapPhase GamePhase = "bootstrap"
+	ScriptPhase    GamePhase = "script"
+	AlliancePhase  GamePhase = "alliance"
+	ObserverPhase  GamePhase = "observer"
+)
+
+// GameError is the failure of a game, reported by its executor.
+type GameError struct {
+	Phase GamePhase
+	Game  string
+	// Org is the org, or comma separated orgs, the failed operation ran for.
+	Org string
+	// Step is the index of the failed script step, or -1 if the failure is
+	// not tied to a step.
+	Step  int
+	Cause error
+}
+
+func (ge *GameError) Error() string {
+	if ge.Step < 0 {
+		return fmt.Sprintf("game %s failed in %s phase for %s: %s",
+			ge.Game, ge.Phase, ge.Org, ge.Cause)
+	}
+	return fmt.Sprintf("game %s failed in %s phase at step %d for %s: %s",
+		ge.Game, ge.Phase, ge.Step, ge.Org, ge.Cause)
+}
+
+// newGameError wraps the cause of a failure outside of the script steps.
+func newGameError(phase GamePhase, game, org string, cause error) *GameError {
+	return &GameError{Phase: phase, Game: game, Org: org, Step: -1, Cause: cause}
+}
+
+// GameErrors are the failures of all games of a run, each reported once.
+type GameErrors []error
+
+func (ge GameErrors) Error() string {
+	msgs := make([]string, len(ge))
+	for i, err := range ge {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d games failed: %s", len(ge), strings.Join(msgs, "; "))
+}
+
+// errOrNil returns the errors, or nil if there are none.
+func (ge GameErrors) errOrNil() error {
+	if len(ge) == 0 {
+		return nil
+	}
+	return ge
+}
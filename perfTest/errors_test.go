@@ -0,0 +1,17 @@
+package tfc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameErrorMessages(t *testing.T) {
+	bootstrapErr := newGameError(BootstrapPhase, "game1", "org1,org2", fmt.Errorf("no orderer"))
+	require.Equal(t, "game game1 failed in bootstrap phase for org1,org2: no orderer", bootstrapErr.Error())
+
+	stepErr := offsetStep(&GameError{Phase: ScriptPhase, Game: "game1", Org: "org2", Step: 2,
+		Cause: fmt.Errorf("rejected")}, 10)
+	require.Equal(t, "game game1 failed in script phase at step 12 for org2: rejected", stepErr.Error())
+}
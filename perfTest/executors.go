@@ -1,11 +1,12 @@
 package tfc
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
@@ -18,11 +19,27 @@ import (
 	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
 )
 
-type asyncExecutor = func(gameName string, respChan chan (error), orgsIn chan ([]string), orgsOut chan ([]string))
+// asyncExecutor plays a game on the leased orgs, and sends the outcome of the
+// game on respChan, as configured by cfg. The bootstrap slot of the lease is
+// freed once the channel of the game is up.
+type asyncExecutor = func(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, respChan chan (error), lease *orgLease)
+
+// withTimeout derives a context with the timeout, or without a deadline if the
+// timeout is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
 
 type scriptStep struct {
 	message proto.Message
 	player  *TFCClient
+	// retry overrides the retry policy of the run for this step.
+	retry *RetryPolicy
+	// thinkTime overrides the think times of the run for this step.
+	thinkTime *ThinkTime
 }
 
 func scriptTTT1(p1, p2 *TFCClient) []scriptStep {
@@ -37,7 +54,7 @@ func scriptTTT1(p1, p2 *TFCClient) []scriptStep {
 	}
 }
 
-type asyncAcriptAllianceGenerator func(int, string, chan error)
+type asyncAcriptAllianceGenerator func(context.Context, *rand.Rand, int, string, chan error)
 
 type ally struct {
 	*TFCClient
@@ -46,7 +63,8 @@ type ally struct {
 
 func scriptTFC1(p1, p2, p3 *TFCClient) ([]scriptStep, asyncAcriptAllianceGenerator) {
 
-	p1C, p2C, p3C := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+	// Players take turns in the chaincode order: RED, BLUE, GREEN
+	p1C, p2C, p3C := tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Player_GREEN
 
 	colors := map[string]tfcPb.Player{
 		p1.OrgID: p1C, p2.OrgID: p2C, p3.OrgID: p3C,
@@ -79,9 +97,8 @@ func scriptTFC1(p1, p2, p3 *TFCClient) ([]scriptStep, asyncAcriptAllianceGenerat
 		s = append(s, s[3:]...)
 	}
 
-	return s, func(i int, gameName string, eOut chan error) {
-		rand.Seed(int64(i))
-		n := rand.Int() % 3
+	return s, func(ctx context.Context, rnd *rand.Rand, i int, gameName string, eOut chan error) {
+		n := rnd.Int() % 3
 
 		a1 := s[n%3].player
 		a2 := s[(n+1)%3].player
@@ -101,7 +118,7 @@ func scriptTFC1(p1, p2, p3 *TFCClient) ([]scriptStep, asyncAcriptAllianceGenerat
 				Args(),
 		}
 
-		eOut <- makeAndMeasureAlliance(gameName, allianceUUID, allies, terms...)
+		eOut <- makeAndMeasureAlliance(ctx, gameName, allianceUUID, allies, terms...)
 
 	}
 }
@@ -113,13 +130,11 @@ type drmItem struct {
 	Item       []byte
 }
 
-func scriptDRM() []drmItem {
-	rand.Seed(time.Now().Unix())
-
+func scriptDRM(rnd *rand.Rand) []drmItem {
 	items := []drmItem{}
 	for i := 0; i < 30; i++ {
 		payload := make([]byte, 8)
-		rand.Read(payload)
+		rnd.Read(payload)
 		items = append(items, drmItem{
 			Author:     "foo" + strconv.Itoa(i),
 			CreateTime: time.Now(),
@@ -131,7 +146,10 @@ func scriptDRM() []drmItem {
 	return items
 }
 
-func execDRMAsync(gameName string, respChan chan (bool), orgsIn chan ([]string), orgsOut chan ([]string)) {
+func execDRMAsync(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, errOut chan (error), lease *orgLease) {
+
+	ctx, cancel := withTimeout(ctx, cfg.GameTimeout)
+	defer cancel()
 
 	ccReq := resmgmt.InstantiateCCRequest{
 		Name:    "drm",
@@ -139,23 +157,30 @@ func execDRMAsync(gameName string, respChan chan (bool), orgsIn chan ([]string),
 		Version: "1.0",
 	}
 
-	orgs := <-orgsIn
-	players, err := bootstrapChannel(gameName, orgs[:2], ccReq)
-	orgsOut <- orgs
+	orgs := lease.orgs
+	players, err := bootstrapChannel(ctx, cfg, gameName, orgs[:2], ccReq, metrics)
+	lease.bootstrapped()
+
+	if err != nil {
+		errOut <- newGameError(BootstrapPhase, gameName, strings.Join(orgs[:2], ","), err)
+		return
+	}
+
 	defer closePlayers(players)
 
-	tttScript1 := scriptDRM()
-	_, err = runScriptDRM(tttScript1, "drm", players)
+	tttScript1 := scriptDRM(cfg.gameRand(gameName))
+	_, err = runScriptDRM(ctx, tttScript1, "drm", players)
 	if err != nil {
-		panic(err)
+		errOut <- err
+		return
 	}
 
 	log.Printf("Finished running test.")
 
-	respChan <- true
+	errOut <- nil
 }
 
-func runScriptDRM(script []drmItem, ccName string, players []*TFCClient) ([]channel.Response, error) {
+func runScriptDRM(ctx context.Context, script []drmItem, ccName string, players []*TFCClient) ([]channel.Response, error) {
 	responses := make([]channel.Response, len(script))
 	for i := range script {
 		msg := script[i]
@@ -166,9 +191,10 @@ func runScriptDRM(script []drmItem, ccName string, players []*TFCClient) ([]chan
 		}
 
 		pID := i % len(players)
-		r, err := invokeAndMeasure(players[pID], ccName, ccName, trxArgs)
+		r, err := invokeAndMeasure(ctx, players[pID], ccName, ccName, trxArgs)
 		if err != nil {
-			return responses, err
+			return responses, &GameError{Phase: ScriptPhase, Game: players[pID].GameName,
+				Org: players[pID].OrgID, Step: i, Cause: err}
 		}
 		responses[i] = r
 	}
@@ -176,55 +202,58 @@ func runScriptDRM(script []drmItem, ccName string, players []*TFCClient) ([]chan
 	return responses, nil
 }
 
-func execTTTGameAsync(gameName string, errOut chan (error), orgsIn chan ([]string), orgsOut chan ([]string)) {
+func execTTTGameAsync(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, errOut chan (error), lease *orgLease) {
 
-	defer recordFailure()
+	ctx, cancel := withTimeout(ctx, cfg.GameTimeout)
+	defer cancel()
 
 	ccReq := resmgmt.InstantiateCCRequest{
 		Name:    "ttt",
-		Path:    "github.com/stefanprisca/strategy-code/tictactoe",
+		Path:    tttCCPath,
 		Version: "1.0",
 	}
 
-	orgs := <-orgsIn
-	players, err := bootstrapAndMeasureChannel(gameName, orgs[:2], ccReq)
-	orgsOut <- orgs
+	orgs := lease.orgs
+	players, err := bootstrapAndMeasureChannel(ctx, cfg, gameName, orgs[:2], ccReq, metrics)
+	lease.bootstrapped()
 
 	if err != nil {
-		errOut <- err
-		panic(err)
+		errOut <- newGameError(BootstrapPhase, gameName, strings.Join(orgs[:2], ","), err)
+		return
 	}
 
 	defer closePlayers(players)
 
 	tttScript1 := scriptTTT1(players[0], players[1])
-	_, err = runGameScript(tttScript1, "ttt", players)
+	think := newThinkTimer(cfg.ThinkTimes, cfg.gameRand(gameName))
+	_, err = runGameScript(ctx, cfg, think, tttScript1, "ttt", players)
 	if err != nil {
 		errOut <- err
-		panic(err)
+		return
 	}
 	log.Printf("Finished running test.")
 
 	errOut <- nil
 }
 
-func execTFCGameAsync(gameName string, errOut chan (error), orgsIn chan ([]string), orgsOut chan ([]string)) {
+func execTFCGameAsync(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, errOut chan (error), lease *orgLease) {
 
-	defer recordFailure()
+	ctx, cancel := withTimeout(ctx, cfg.GameTimeout)
+	defer cancel()
 
 	ccReq := resmgmt.InstantiateCCRequest{
 		Name:    "tfc",
-		Path:    "github.com/stefanprisca/strategy-code/cmd/tfc",
+		Path:    tfcCCPath,
 		Version: "1.0",
 	}
 
-	orgs := <-orgsIn
-	players, err := bootstrapAndMeasureChannel(gameName, orgs, ccReq)
-	orgsOut <- orgs
+	orgs := lease.orgs
+	players, err := bootstrapAndMeasureChannel(ctx, cfg, gameName, orgs, ccReq, metrics)
+	lease.bootstrapped()
 
 	if err != nil {
-		errOut <- err
-		panic(err)
+		errOut <- newGameError(BootstrapPhase, gameName, strings.Join(orgs, ","), err)
+		return
 	}
 
 	defer closePlayers(players)
@@ -236,17 +265,19 @@ func execTFCGameAsync(gameName string, errOut chan (error), orgsIn chan ([]strin
 	// 	panic(err)
 	// }
 	allianceErrOut := make(chan (error), len(tfcScript))
+	rnd := cfg.gameRand(gameName)
+	think := newThinkTimer(cfg.ThinkTimes, rnd)
 
 	j := 0
 	stepSize := 12
 	for i := 0; i < len(tfcScript); i += stepSize {
-		_, err = runGameScript(tfcScript[j:i], "tfc", players)
+		_, err = runGameScript(ctx, cfg, think, tfcScript[j:i], "tfc", players)
 		if err != nil {
-			errOut <- err
-			panic(err)
+			errOut <- offsetStep(err, j)
+			return
 		}
 
-		alGenerator(i, gameName, allianceErrOut)
+		alGenerator(ctx, rnd, i, gameName, allianceErrOut)
 		j = i
 	}
 
@@ -256,16 +287,102 @@ func execTFCGameAsync(gameName string, errOut chan (error), orgsIn chan ([]strin
 		log.Printf("Waiting for alliances to create...%d", j)
 		err = <-allianceErrOut
 		if err != nil {
-
 			errOut <- err
-			panic(err)
+			return
 		}
 	}
 
-	errOut <- nil
+	errOut <- observerFailure(players)
 }
 
-func runGameScript(script []scriptStep, ccName string, players []*TFCClient) ([]channel.Response, error) {
+// newScriptExecutor loads a game script definition, and returns an executor
+// playing it. When the script defines alliances, one is created before every
+// chunk of steps.
+func newScriptExecutor(scriptPath string) (asyncExecutor, error) {
+	def, err := loadGameScript(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, errOut chan (error), lease *orgLease) {
+
+		ctx, cancel := withTimeout(ctx, cfg.GameTimeout)
+		defer cancel()
+
+		ccReq := resmgmt.InstantiateCCRequest{
+			Name:    def.ccName(),
+			Path:    def.ccPath(),
+			Version: "1.0",
+		}
+
+		orgs := lease.orgs
+		chanOrgs := orgs[:len(def.Players)]
+		players, err := bootstrapAndMeasureChannel(ctx, cfg, gameName, chanOrgs, ccReq, metrics)
+		lease.bootstrapped()
+
+		if err != nil {
+			errOut <- newGameError(BootstrapPhase, gameName, strings.Join(chanOrgs, ","), err)
+			return
+		}
+
+		defer closePlayers(players)
+
+		script, alGenerator, err := def.build(players)
+		if err != nil {
+			errOut <- newGameError(ScriptPhase, gameName, strings.Join(chanOrgs, ","), err)
+			return
+		}
+
+		rnd := cfg.gameRand(gameName)
+		think := newThinkTimer(cfg.ThinkTimes, rnd)
+		stepSize := len(script)
+		if alGenerator != nil {
+			stepSize = def.Alliances.Every
+		}
+		if stepSize < 1 {
+			stepSize = 1
+		}
+
+		allianceErrOut := make(chan (error), len(script)/stepSize+1)
+		nOfAlliances := 0
+		for i := 0; i < len(script); i += stepSize {
+			if alGenerator != nil {
+				alGenerator(ctx, rnd, i, gameName, allianceErrOut)
+				nOfAlliances++
+			}
+
+			end := i + stepSize
+			if end > len(script) {
+				end = len(script)
+			}
+			_, err = runGameScript(ctx, cfg, think, script[i:end], ccReq.Name, players)
+			if err != nil {
+				errOut <- offsetStep(err, i)
+				return
+			}
+		}
+
+		log.Printf("Finished running test.")
+
+		for ; nOfAlliances > 0; nOfAlliances-- {
+			log.Printf("Waiting for alliances to create...%d", nOfAlliances)
+			err = <-allianceErrOut
+			if err != nil {
+				errOut <- err
+				return
+			}
+		}
+
+		errOut <- observerFailure(players)
+	}, nil
+}
+
+// runGameScript plays the script steps in order, each after the think time of
+// its player. Failed steps are retried as allowed by the retry policy of the
+// step, or else of cfg. The script stops at the first step which fails for good: with a
+// RetryError once the policy gives up, or with the context error once the
+// step times out or the game context is done.
+func runGameScript(ctx context.Context, cfg *RunConfig, think *thinkTimer, script []scriptStep, ccName string, players []*TFCClient) ([]channel.Response, error) {
 	responses := make([]channel.Response, len(script))
 	for i := 0; i < len(script); i++ {
 		msg := script[i].message
@@ -273,32 +390,28 @@ func runGameScript(script []scriptStep, ccName string, players []*TFCClient) ([]
 		log.Printf("Executing script step %v", msg)
 		trxArgs, err := proto.Marshal(msg)
 		if err != nil {
-			return responses, err
+			return responses, &GameError{Phase: ScriptPhase, Game: player.GameName,
+				Org: player.OrgID, Step: i, Cause: err}
 		}
 
-		ms := rand.Intn(500) + 100
-		stepInterval, _ := time.ParseDuration(fmt.Sprintf("%vms", ms))
-		time.Sleep(stepInterval)
-
-		r, err := invokeAndMeasure(player, ccName, ccName, trxArgs)
+		thinkTime, err := think.next(script[i])
+		if err != nil {
+			return responses, &GameError{Phase: ScriptPhase, Game: player.GameName,
+				Org: player.OrgID, Step: i, Cause: err}
+		}
 
+		r, err := runScriptStep(ctx, cfg, thinkTime, script[i], ccName, trxArgs)
 		if err != nil {
-			log.Println(err.Error())
-			i--
-			continue
+			return responses, &GameError{Phase: ScriptPhase, Game: player.GameName,
+				Org: player.OrgID, Step: i, Cause: err}
 		}
 
 		if gcArgs, ok := script[i].message.(*tfcPb.GameContractTrxArgs); ok {
 
 			for _, ccReg := range player.GameObservers {
-				if ccReg.terminated {
-					continue
-				}
-
-				notifyArgs := &tfcPb.TrxCompletedArgs{
+				ccReg.Notify(&tfcPb.TrxCompletedArgs{
 					CompletedTrxArgs: gcArgs,
-				}
-				ccReg.TrxComplete <- notifyArgs
+				})
 			}
 		}
 
@@ -307,3 +420,47 @@ func runGameScript(script []scriptStep, ccName string, players []*TFCClient) ([]
 
 	return responses, nil
 }
+
+// offsetStep shifts the step of a script error by the index of the first step
+// of the script chunk it occurred in.
+func offsetStep(err error, first int) error {
+	if ge, ok := err.(*GameError); ok && ge.Step >= 0 {
+		ge.Step += first
+	}
+	return err
+}
+
+// runScriptStep invokes the chaincode after the think time, and retries it
+// as allowed by the retry policy of the step, or else of cfg. It returns a
+// RetryError once the policy gives up, or the context error once the step
+// times out.
+func runScriptStep(ctx context.Context, cfg *RunConfig, thinkTime time.Duration, step scriptStep, ccName string, trxArgs []byte) (channel.Response, error) {
+	ctx, cancel := withTimeout(ctx, cfg.StepTimeout)
+	defer cancel()
+
+	policy := cfg.Retry
+	if step.retry != nil {
+		policy = *step.retry
+	}
+
+	wait := thinkTime
+	for attempts := 1; ; attempts++ {
+		select {
+		case <-ctx.Done():
+			return channel.Response{}, ctx.Err()
+		case <-time.After(wait):
+		}
+
+		r, err := invokeAndMeasure(ctx, step.player, ccName, ccName, trxArgs)
+		if err == nil {
+			return r, nil
+		}
+
+		class := classifyError(err)
+		if !policy.retries(attempts, class) {
+			return r, &RetryError{Attempts: attempts, Class: class, Last: err}
+		}
+		wait = policy.backoff(attempts)
+		log.Printf("Attempt %d failed with a %s error, retrying in %s: %s", attempts, class, wait, err)
+	}
+}
@@ -0,0 +1,54 @@
+package tfc
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameRandIsReproducible(t *testing.T) {
+	cfg := &RunConfig{Seed: 42}
+
+	draw := func(rnd *rand.Rand) []int {
+		return []int{rnd.Int(), rnd.Int(), rnd.Int()}
+	}
+
+	require.Equal(t, draw(cfg.gameRand("game1")), draw(cfg.gameRand("game1")))
+	require.NotEqual(t, draw(cfg.gameRand("game1")), draw(cfg.gameRand("game2")),
+		"expected games to have different sources")
+
+	first := draw(cfg.gameRand("game1"))
+	cfg.Seed = 43
+	require.NotEqual(t, first, draw(cfg.gameRand("game1")), "expected seeds to change the sources")
+}
+
+func TestAlliancePartnersAreReproducible(t *testing.T) {
+	cfg := &RunConfig{Seed: 42}
+
+	def, err := loadGameScript("scripts/tfc1.yaml")
+	require.NoError(t, err, "could not load script")
+	// Without a game channel the alliances fail, reporting the chosen allies
+	players, err := NewSimLedger().Connect(context.Background(), DefaultRunConfig(), "game1", []string{Player1, Player2, Player3})
+	require.NoError(t, err)
+	for _, p := range players {
+		p.Metrics = newTestMetrics(t)
+	}
+	_, alGenerator, err := def.build(players)
+	require.NoError(t, err, "could not build script")
+
+	allies := func() []string {
+		rnd := cfg.gameRand("game1")
+		orgs := []string{}
+		for i := 0; i < 4; i++ {
+			errOut := make(chan error, 1)
+			alGenerator(context.Background(), rnd, i, "game1", errOut)
+			err := <-errOut
+			require.IsType(t, &GameError{}, err)
+			orgs = append(orgs, err.(*GameError).Org)
+		}
+		return orgs
+	}
+	require.Equal(t, allies(), allies())
+}
@@ -0,0 +1,46 @@
+package tfc
+
+import (
+	"context"
+)
+
+// Experiment runs a performance experiment as configured by cfg, observing
+// into metrics. The names of the games it creates start with runName, and
+// must be unique on the network. Cancelling ctx aborts the experiment.
+type Experiment func(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error
+
+// Experiments are the experiments selectable by name.
+var Experiments = map[string]Experiment{
+	// a single TTT game
+	"ttt": func(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+		return runSingle(ctx, cfg, runName, metrics, execTTTGameAsync)
+	},
+	// a single TFC game, with alliances
+	"tfc": func(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+		return runSingle(ctx, cfg, runName, metrics, execTFCGameAsync)
+	},
+	// 4 concurrent TFC games
+	"static": staticStages.run,
+	// an increasing number of concurrent TTT and TFC games, from 2 to 16
+	"incremental": func(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+		return incrementalStages(cfg.Network).run(ctx, cfg, runName, metrics)
+	},
+	// a burst of 16 concurrent games between a few TTT games
+	"spike": spikeStages.run,
+	// transactions issued at the arrival rate of the OpenLoad of the config
+	"openloop": func(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+		return runOpenLoop(ctx, cfg, runName, metrics, cfg.OpenLoad)
+	},
+}
+
+// runSingle plays a single game on the first org set of the network.
+func runSingle(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics, asyncExec asyncExecutor) error {
+	respChan := make(chan (error), 1)
+	lease := leaseOrgs(cfg.Network.OrgSets[0], metrics)
+	defer lease.release()
+
+	asyncExec(ctx, cfg, runName, metrics, respChan, lease)
+	err := <-respChan
+	cfg.finishGameArtifacts(runName, err)
+	return err
+}
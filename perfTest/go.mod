@@ -18,7 +18,9 @@ require (
 	github.com/google/certificate-transparency-go v1.0.21 // indirect
 	github.com/hyperledger/fabric v1.4.1
 	github.com/hyperledger/fabric-sdk-go v1.0.0-alpha5
+	github.com/pkg/errors v0.8.1
 	github.com/prometheus/client_golang v0.9.2
+	github.com/prometheus/client_model v0.0.0-20180712105110-5c3871d89910
 	github.com/stefanprisca/strategy-code v0.0.0-20190508095113-1cf6ba76bd11 // indirect
 	github.com/stefanprisca/strategy-code/prettyprint v0.0.0-20190508095113-1cf6ba76bd11
 	github.com/stefanprisca/strategy-code/tfc v0.0.0-20190519101532-421e923decd9
@@ -26,4 +28,5 @@ require (
 	github.com/stretchr/testify v1.3.0
 	gonum.org/v1/gonum v0.0.0-20190509213835-50179cd3f3f7
 	gonum.org/v1/plot v0.0.0-20190410204940-3a5f52653745
+	gopkg.in/yaml.v2 v2.2.2
 )
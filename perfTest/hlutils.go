@@ -1,13 +1,12 @@
 package tfc
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -19,196 +18,163 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/pkg/errors"
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
-func bootstrapAndMeasureChannel(gameName string, chanOrgs []string, ccReq resmgmt.InstantiateCCRequest) ([]*TFCClient, error) {
+func bootstrapAndMeasureChannel(ctx context.Context, cfg *RunConfig, gameName string, chanOrgs []string, ccReq resmgmt.InstantiateCCRequest, metrics *PlayerMetrics) ([]*TFCClient, error) {
 
 	// Observe a 0 to boot the ops measurement
-	GetPlayerMetrics().
-		With(CCLabel, "Operations").
-		With(CCFailedLabel, "False").
-		Observe(0)
+	metrics.Observe("Operations", false, 0)
 
 	st := time.Now()
-	p, err := bootstrapChannel(gameName, chanOrgs, ccReq)
+	p, err := bootstrapChannel(ctx, cfg, gameName, chanOrgs, ccReq, metrics)
 	rt := time.Since(st).Seconds()
 
+	metrics.Record(RunRecord{Time: st, Game: gameName, Op: BootstrapOp,
+		Org: strings.Join(chanOrgs, ","), CC: ccReq.Name}, rt, err)
+
 	if err != nil {
+		metrics.Observe("Operations", true, rt)
 		return p, err
 	}
 
-	GetPlayerMetrics().
-		With(CCLabel, "Operations").
-		With(CCFailedLabel, "False").
-		Observe(rt)
+	metrics.Observe("Operations", false, rt)
 	return p, err
 }
 
-func bootstrapChannel(gameName string, chanOrgs []string, ccReq resmgmt.InstantiateCCRequest) ([]*TFCClient, error) {
-
-	cfgPath, err := generateChannelArtifacts(gameName, chanOrgs)
-	if err != nil {
-		return nil, err
-	}
+func bootstrapChannel(ctx context.Context, cfg *RunConfig, gameName string, chanOrgs []string, ccReq resmgmt.InstantiateCCRequest, metrics *PlayerMetrics) ([]*TFCClient, error) {
 
-	players, err := generatePlayers(cfgPath, chanOrgs, gameName)
+	players, err := cfg.Ledger.Connect(ctx, cfg, gameName, chanOrgs)
 	if err != nil {
 		return nil, err
 	}
+	resources := &gameResources{}
 	for _, p := range players {
-		p.Metrics = GetPlayerMetrics()
+		p.GameName = gameName
+		p.Metrics = metrics
+		p.resources = resources
 	}
 
 	// ccPath := "github.com/stefanprisca/strategy-code/tictactoe"
 	// os.Setenv("GOPATH", "/home/stefan/workspace/hyperledger/caliper/packages/caliper-application")
 	//ccPath := "github.com/stefanprisca/strategy-code/tictactoe"
-	err = startGame(players, cfgPath, gameName, ccReq)
+	err = startGame(ctx, players, gameName, ccReq)
 	if err != nil {
 		return nil, err
 	}
 	return players, nil
 }
 
-type genScriptData struct {
-	Orgs          []string
-	FabricCfgPath string
-	ChannelName   string
-}
+// generateChannelArtifacts renders the configtx.yaml of the channel, and
+// writes the channel creation transaction and the anchor peer updates of its
+// game channel profile to the workspace of the game. It returns the folder
+// holding them.
+func generateChannelArtifacts(cfg *RunConfig, channelName string, chanOrgs []string) (string, error) {
+	netOrgs, err := cfg.Network.channelOrgs(chanOrgs)
+	if err != nil {
+		return "", fmt.Errorf("could not generate channel cfg: %s", err)
+	}
 
-func generateChannelArtifacts(channelName string, chanOrgs []string) (string, error) {
-	/*
-		1) Fill out chan template
-		2) Generate using configtex tool
-		3) Submit chan transaction
-		4) Join channel.
-	*/
-	cfgPath := path.Join(scfixturesPath, "temp", channelName)
-	err := os.MkdirAll(cfgPath, 0777)
+	cfgPath, err := cfg.artifacts.workspace(channelName)
 	if err != nil {
-		return "", fmt.Errorf("Could not create config path. %s", err)
+		return "", err
 	}
 
-	cfgFilePath := path.Join(cfgPath, "configtx.yaml")
-	err = executeTemplate(cfgFilePath, "configtx.yaml_template", chanOrgs)
+	configtxPath := path.Join(cfgPath, "configtx.yaml")
+	err = executeTemplate(cfg.TemplateDir, configtxPath, "configtx.yaml_template", configtxData{netOrgs, cfg.Network})
 	if err != nil {
 		return "", fmt.Errorf("could not generate channel cfg: %s", err)
 	}
+	cfg.artifacts.record(channelName, configtxPath)
 
-	genScriptPath := path.Join(cfgPath, "generateChan.sh")
-	genScriptData := genScriptData{chanOrgs, cfgPath, channelName}
-	err = executeTemplate(genScriptPath, "generateChan.sh_template", genScriptData)
+	profile, err := loadChannelProfile(configtxPath, gameChannelProfile)
 	if err != nil {
 		return "", fmt.Errorf("could not generate channel cfg: %s", err)
 	}
 
-	fmt.Println(cfgPath)
-
-	changen := exec.Command("/bin/sh", genScriptPath, channelName)
-
-	changen.Env = os.Environ()
-	changen.Env = append(changen.Env, "FABRIC_CFG_PATH="+cfgPath)
-	result, err := changen.CombinedOutput()
-	print(result)
+	files, err := writeChannelArtifacts(cfgPath, channelName, profile, netOrgs)
+	cfg.artifacts.record(channelName, files...)
 	if err != nil {
-		return "", fmt.Errorf("Failed to execute commad. %s \n %s", err.Error(), string(result))
+		return "", fmt.Errorf("could not generate channel cfg: %s", err)
 	}
-
 	return cfgPath, nil
 }
 
+// pConfigData holds the org a client config is for, and the orgs of its
+// channel. Network holds all the orgs, which the client can reach.
 type pConfigData struct {
-	For  string
-	Orgs []string
+	For     NetworkOrg
+	Orgs    []NetworkOrg
+	Network Network
 }
 
-func generatePlayers(cfgPath string, chanOrgs []string, gameName string) ([]*TFCClient, error) {
+func generatePlayers(cfg *RunConfig, cfgPath string, chanOrgs []string, gameName string) ([]*TFCClient, error) {
 
 	players := []*TFCClient{}
-	lowCapOrgs := []string{}
-	for _, org := range chanOrgs {
-		lowCapOrgs = append(lowCapOrgs, strings.ToLower(org))
+	netOrgs, err := cfg.Network.channelOrgs(chanOrgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not create client cfg: %s", err)
 	}
 
-	for i, org := range chanOrgs {
-		cfgName := org + "Config.yaml"
+	endorsers := newEndorserSelector(cfg.Endorsement, netOrgs, cfg.gameRand(gameName+"endorsers"))
+	for _, netOrg := range netOrgs {
+		cfgName := netOrg.Name + "Config.yaml"
 		clientCfg := path.Join(cfgPath, cfgName)
 
 		tplName := "pConfig.yaml_template"
-		tlpData := pConfigData{lowCapOrgs[i], lowCapOrgs}
-		err := executeTemplate(clientCfg, tplName, tlpData)
+		tlpData := pConfigData{netOrg, netOrgs, cfg.Network}
+		err := executeTemplate(cfg.TemplateDir, clientCfg, tplName, tlpData)
 		if err != nil {
 			return nil, fmt.Errorf("could not create client cfg: %s", err)
 		}
+		cfg.artifacts.record(gameName, clientCfg)
 
-		c, err := NewTFCClient(cfgPath, clientCfg, org, gameName)
+		c, err := NewTFCClient(cfgPath, clientCfg, cfg.Network, netOrg.Name, gameName)
 		if err != nil {
 			return nil, fmt.Errorf("could not create new client: %s", err)
 		}
+		c.endorsers = endorsers
+		c.cfg = cfg
 		players = append(players, c)
 	}
 
 	return players, nil
 }
 
+// closePlayers ends the game of the players: it stops the alliance
+// observers, releases the clients, and cleans up the network.
 func closePlayers(players []*TFCClient) {
 	for _, p := range players {
-		p.SDK.Close()
+		p.Ledger.Close(p)
 		for _, ccReg := range p.GameObservers {
-			if ccReg.terminated {
-				continue
-			}
-			ccReg.Shutdown <- true
+			ccReg.Stop()
 		}
 	}
+	cleanupGame(players)
 }
 
-func executeTemplate(filePath, tplName string, data interface{}) error {
-
-	resultFile, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("Could not create file. %s", err)
-	}
-	defer resultFile.Close()
-
-	tplPath := path.Join("templates", "fabric", tplName)
-	tmpl, err := template.ParseFiles(tplPath)
-	if err != nil {
-		return fmt.Errorf("Could not load template. %s", err)
-	}
-	tmpl.Execute(resultFile, data)
-	return nil
-}
-
-func startGame(players []*TFCClient, chanCfg, chanName string, ccReq resmgmt.InstantiateCCRequest) error {
-	chanTxPath := path.Join(chanCfg, chanName+".tx")
+func startGame(ctx context.Context, players []*TFCClient, chanName string, ccReq resmgmt.InstantiateCCRequest) error {
 
 	// Create the game channel
-	p1 := players[0]
-	signatures := getSignatures(players)
-	err := createChannel(p1, signatures, chanName, chanTxPath)
+	ledger := players[0].Ledger
+	err := ledger.CreateChannel(ctx, players, chanName)
 	if err != nil {
 		return fmt.Errorf("could not create game channel: %s", err)
 	}
+	players[0].resources.addChannel(chanName)
 
 	// join all the peers to the channel
 	for _, p := range players {
-		err = joinGame(p, chanName)
-		if err != nil {
-			return fmt.Errorf("could not join game channel: %s", err)
-		}
-		err = updateAnchorPeers(p, chanName)
-		if err != nil {
-			return fmt.Errorf("could not update anchor peers: %s", err)
-		}
-
-		err = updateChannelClient(p, chanName)
+		err = ledger.JoinChannel(ctx, p, chanName)
 		if err != nil {
-			return fmt.Errorf("could not update anchor peers: %s", err)
+			return err
 		}
 	}
 
-	return runChaincode(players, ccReq, chanName, [][]byte{})
+	players[0].resources.addChaincode(chaincodeResource{
+		name: ccReq.Name, version: ccReq.Version, peers: peersOf(players)})
+	return runChaincode(ctx, players, ccReq, chanName, [][]byte{})
 }
 
 func getSignatures(players []*TFCClient) []msp.SigningIdentity {
@@ -219,7 +185,7 @@ func getSignatures(players []*TFCClient) []msp.SigningIdentity {
 	return result
 }
 
-func createChannel(player *TFCClient, signatures []msp.SigningIdentity, chanName, chanTxPath string) error {
+func createChannel(ctx context.Context, player *TFCClient, signatures []msp.SigningIdentity, chanName, chanTxPath string) error {
 
 	r, err := os.Open(chanTxPath)
 	if err != nil {
@@ -234,7 +200,8 @@ func createChannel(player *TFCClient, signatures []msp.SigningIdentity, chanName
 			ChannelConfig:     r,
 			SigningIdentities: signatures,
 		},
-		resmgmt.WithOrdererEndpoint(OrdererEndpoint),
+		resmgmt.WithOrdererEndpoint(player.Network.ordererEndpoint()),
+		resmgmt.WithParentContext(ctx),
 		resmgmt.WithRetry(retry.DefaultResMgmtOpts))
 	if err != nil {
 		return fmt.Errorf("failed to save channel: %s", err)
@@ -247,20 +214,21 @@ func createChannel(player *TFCClient, signatures []msp.SigningIdentity, chanName
 	return nil
 }
 
-func joinGame(player *TFCClient, chanName string) error {
+func joinGame(ctx context.Context, player *TFCClient, chanName string) error {
 	log.Printf("Joining channel for peer %s channel: %s", player.OrgID, chanName)
 
 	orgResMgmt := player.ResMgmt
 	// Org peers join channel
 	if err := orgResMgmt.JoinChannel(chanName,
+		resmgmt.WithParentContext(ctx),
 		resmgmt.WithRetry(retry.DefaultResMgmtOpts),
-		resmgmt.WithOrdererEndpoint(OrdererEndpoint)); err != nil {
+		resmgmt.WithOrdererEndpoint(player.Network.ordererEndpoint())); err != nil {
 		return fmt.Errorf("Org %s peers failed to JoinChannel: %s", player.OrgID, err)
 	}
 	return nil
 }
 
-func updateAnchorPeers(player *TFCClient, chanName string) error {
+func updateAnchorPeers(ctx context.Context, player *TFCClient, chanName string) error {
 	log.Printf("Updating anchor peers for %s channel: %s", player.OrgID, chanName)
 	signs := []msp.SigningIdentity{player.SigningIdentity}
 	req := resmgmt.SaveChannelRequest{
@@ -271,8 +239,9 @@ func updateAnchorPeers(player *TFCClient, chanName string) error {
 
 	orgResMgmt := player.ResMgmt
 	tx, err := orgResMgmt.SaveChannel(req,
+		resmgmt.WithParentContext(ctx),
 		resmgmt.WithRetry(retry.DefaultResMgmtOpts),
-		resmgmt.WithOrdererEndpoint(OrdererEndpoint))
+		resmgmt.WithOrdererEndpoint(player.Network.ordererEndpoint()))
 	if err != nil {
 		return fmt.Errorf("Anchor peers failed to update for channel: %s", err)
 	}
@@ -284,37 +253,17 @@ func updateAnchorPeers(player *TFCClient, chanName string) error {
 	return nil
 }
 
-func deployChaincode(ccPath, name string,
-	players []*TFCClient) (*resmgmt.InstallCCRequest, error) {
-
-	ccPkg, err := createCC(ccPath)
-	if err != nil {
-		return nil, fmt.Errorf("could not create cc package: %s", err)
-	}
+func deployChaincode(ctx context.Context, ccPath, name string, players []*TFCClient) error {
 
 	// Install game chaincode to the peers
-	ccReq := &resmgmt.InstallCCRequest{
+	ccReq := resmgmt.InstallCCRequest{
 		Name:    name,
 		Path:    ccPath,
 		Version: "1.0",
-		Package: ccPkg}
-
-	if err != nil {
-		return nil, fmt.Errorf("could not create cc policy: %s", err)
 	}
 
-	for _, player := range players {
-		orgResMgmt := player.ResMgmt
-		log.Printf("Installing chaincode %s for %s", ccReq.Name, player.OrgID)
-		_, err := orgResMgmt.InstallCC(*ccReq,
-			resmgmt.WithRetry(retry.DefaultResMgmtOpts),
-			resmgmt.WithTargetEndpoints(player.PeerEndpoint))
-		if err != nil {
-			return nil, fmt.Errorf("failed to install cc: %s", err)
-		}
-	}
-
-	return ccReq, nil
+	log.Printf("Installing chaincode %s for %d players", ccReq.Name, len(players))
+	return players[0].Ledger.InstallCC(ctx, players, ccReq)
 }
 
 func createCC(ccPath string) (*resource.CCPackage, error) {
@@ -329,7 +278,7 @@ func createCC(ccPath string) (*resource.CCPackage, error) {
 func updateChannelClient(p *TFCClient, gameName string) error {
 
 	clientChannelContext := p.SDK.ChannelContext(gameName,
-		fabsdk.WithUser(User),
+		fabsdk.WithUser(p.Network.User),
 		fabsdk.WithOrg(p.OrgID))
 
 	// Channel client is used to query and execute transactions (Org1 is default org)
@@ -343,7 +292,7 @@ func updateChannelClient(p *TFCClient, gameName string) error {
 	return nil
 }
 
-func runChaincode(players []*TFCClient,
+func runChaincode(ctx context.Context, players []*TFCClient,
 	ccReq resmgmt.InstantiateCCRequest,
 	chanName string,
 	initArgs [][]byte) error {
@@ -363,17 +312,14 @@ func runChaincode(players []*TFCClient,
 		ccReq.Name, p1.OrgID, chanName, ccPolicy)
 	// Org resource manager will instantiate 'example_cc' on channel
 
-	teps := make([]string, len(players))
-	for i, p := range players {
-		teps[i] = p.PeerEndpoint
-	}
-
 	colDefinitions, err := getCollectionDefinitions(players)
 	if err != nil {
 		return fmt.Errorf("failed to create collection definitions: %v", err)
 	}
 
-	_, err = p1.ResMgmt.InstantiateCC(
+	return p1.Ledger.InstantiateCC(
+		ctx,
+		players,
 		chanName,
 		resmgmt.InstantiateCCRequest{
 			Name:       ccReq.Name,
@@ -382,49 +328,37 @@ func runChaincode(players []*TFCClient,
 			Args:       initArgs,
 			Policy:     ccPolicy,
 			CollConfig: colDefinitions,
-		},
-		resmgmt.WithRetry(retry.DefaultResMgmtOpts),
-		resmgmt.WithTargetEndpoints(teps...),
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to instantiate cc: %s", err)
-	}
-
-	return err
+		})
 }
 
-func makeAndMeasureAlliance(gameName string, allianceUUID uint32, allies []*ally, terms ...*tfcPb.GameContractTrxArgs) error {
+func makeAndMeasureAlliance(ctx context.Context, gameName string, allianceUUID uint32, allies []*ally, terms ...*tfcPb.GameContractTrxArgs) error {
 
 	st := time.Now()
-	err := makeAlliance(gameName, allianceUUID, allies, terms...)
+	err := makeAlliance(ctx, gameName, allianceUUID, allies, terms...)
 	rt := time.Since(st).Seconds()
 
+	allies[0].Metrics.Record(RunRecord{Time: st, Game: gameName, Op: AllianceOp,
+		Org: allies[0].OrgID + "," + allies[1].OrgID, CC: "alliance"}, rt, err)
+
 	if err != nil {
-		GetPlayerMetrics().
-			With(CCLabel, "Operations").
-			With(CCFailedLabel, "True").
-			Observe(rt)
-		return err
+		allies[0].Metrics.Observe("Operations", true, rt)
+		return newGameError(AlliancePhase, gameName, allies[0].OrgID+","+allies[1].OrgID, err)
 	}
 
-	GetPlayerMetrics().
-		With(CCLabel, "Operations").
-		With(CCFailedLabel, "False").
-		Observe(rt)
+	allies[0].Metrics.Observe("Operations", false, rt)
 
 	return err
 }
 
-func makeAlliance(gameName string, allianceUUID uint32, allies []*ally, terms ...*tfcPb.GameContractTrxArgs) error {
+func makeAlliance(ctx context.Context, gameName string, allianceUUID uint32, allies []*ally, terms ...*tfcPb.GameContractTrxArgs) error {
 
-	allianceCCPath := "local-cc/alliance"
+	allianceCCLocalPath := "local-cc/alliance"
 	log.Printf("Creating alliance for players %v %v...", allies[0].OrgID, allies[1].OrgID)
 	allianceName := gameName + fmt.Sprintf("%d", allianceUUID)
 	players := []*TFCClient{allies[0].TFCClient, allies[1].TFCClient}
 	// Alliance still needs to be deployed as a specific CC.
 	// Endorsment policies don't work otheriwse
-	_, err := deployChaincode(allianceCCPath, allianceName, players)
+	err := deployChaincode(ctx, allianceCCLocalPath, allianceName, players)
 	if err != nil {
 		return err
 	}
@@ -433,10 +367,13 @@ func makeAlliance(gameName string, allianceUUID uint32, allies []*ally, terms ..
 
 	ccReq := resmgmt.InstantiateCCRequest{
 		Name:    allianceName,
-		Path:    "github.com/stefanprisca/strategy-code/cmd/alliance",
+		Path:    allianceCCPath,
 		Version: "1.0",
 	}
-	err = runChaincode(players, ccReq, gameName, [][]byte{})
+	// The alliance container may start even if the instantiation fails
+	players[0].resources.addChaincode(chaincodeResource{
+		name: allianceName, version: ccReq.Version, peers: peersOf(players), alliance: true})
+	err = runChaincode(ctx, players, ccReq, gameName, [][]byte{})
 	if err != nil {
 		return err
 	}
@@ -464,23 +401,21 @@ func makeAlliance(gameName string, allianceUUID uint32, allies []*ally, terms ..
 
 	log.Printf("Installing the alliance chaincode...")
 
-	_, err = invokeAndMeasure(allies[0].TFCClient, allianceName, "alliance", protoData)
+	_, err = invokeAndMeasure(ctx, allies[0].TFCClient, allianceName, "alliance", protoData)
 	if err != nil {
 		return err
 	}
 
-	registerAllianceListener(allies, allianceUUID, allianceName)
+	registerAllianceListener(ctx, allies, allianceUUID, allianceName)
 
 	return nil
 }
 
-func registerAllianceListener(allies []*ally, observerID uint32, allianceName string) *GameObserver {
+func registerAllianceListener(ctx context.Context, allies []*ally, observerID uint32, allianceName string) *GameObserver {
 
-	shutdown := make(chan bool, 100)
-	trxComplete := make(chan *tfcPb.TrxCompletedArgs, 100)
-	observer := &GameObserver{trxComplete, shutdown, allianceName, observerID, false}
+	observer := newGameObserver(allianceName, observerID)
 
-	go handleAllianceEventsAsync(allies, observer)
+	go handleAllianceEventsAsync(ctx, allies, observer)
 
 	for _, a := range allies {
 		a.GameObservers = append(a.GameObservers, observer)
@@ -489,10 +424,39 @@ func registerAllianceListener(allies []*ally, observerID uint32, allianceName st
 	return observer
 }
 
-func handleAllianceEventsAsync(allies []*ally, gameObserver *GameObserver) {
-	defer recordFailure()
+// observerFailure returns the first failure reported by the alliance observers
+// of the players, if any.
+func observerFailure(players []*TFCClient) error {
+	for _, p := range players {
+		for _, ccReg := range p.GameObservers {
+			select {
+			case err := <-ccReg.Failure:
+				return err
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// handleAllianceEventsAsync forwards the completed game transactions to the
+// alliance chaincode until the alliance completes, the observer is stopped or
+// the game context is done. If forwarding fails, the observer reports the
+// failure and terminates. The game keeps playing, its notifications to the
+// terminated observer are dropped.
+func handleAllianceEventsAsync(ctx context.Context, allies []*ally, gameObserver *GameObserver) {
+	fail := func(err error) {
+		gameObserver.Failure <- newGameError(ObserverPhase, allies[0].GameName,
+			allies[0].OrgID+","+allies[1].OrgID, err)
+		gameObserver.Terminate()
+	}
+
 	for {
 		select {
+		case <-ctx.Done():
+			log.Printf("game ended before alliance %s completed...terminating", gameObserver.Name)
+			gameObserver.Terminate()
+			return
 		case <-gameObserver.Shutdown:
 			log.Println("received shutdown message...terminating")
 			gameObserver.Terminate()
@@ -510,19 +474,22 @@ func handleAllianceEventsAsync(allies []*ally, gameObserver *GameObserver) {
 			}
 			protoData, err := proto.Marshal(alliTrxArgs)
 			if err != nil {
-				panic(err)
+				fail(err)
+				return
 			}
 
-			r, err := invokeAndMeasure(allies[0].TFCClient, gameObserver.Name, "alliance", protoData)
+			r, err := invokeAndMeasure(ctx, allies[0].TFCClient, gameObserver.Name, "alliance", protoData)
 			if err != nil {
-				panic(err)
+				fail(err)
+				return
 			}
 
 			allianceResp := &tfcPb.AllianceData{}
 			err = proto.Unmarshal(r.Payload, allianceResp)
 			if err != nil {
-				panic(fmt.Errorf("failed to unmarshal response %s, %v",
+				fail(fmt.Errorf("failed to unmarshal response %s, %v",
 					r.Payload, err))
+				return
 			}
 
 			log.Printf("Got alliance response  %v", allianceResp)
@@ -542,54 +509,47 @@ func handleAllianceEventsAsync(allies []*ally, gameObserver *GameObserver) {
 
 }
 
-func invokeAndMeasure(player *TFCClient, ccName, ccLabel string, trxArgs []byte) (channel.Response, error) {
+func invokeAndMeasure(ctx context.Context, player *TFCClient, ccName, ccLabel string, trxArgs []byte) (channel.Response, error) {
+
+	player.Metrics.Submitted.With(player.Metrics.ccLabels(ccLabel)...).Add(1)
+	player.Metrics.InFlight.With(player.Metrics.ccLabels(ccLabel)...).Add(1)
 
 	st := time.Now()
-	r, err := invokeGameChaincode(player, ccName, trxArgs)
+	r, phases, err := invokeGameChaincode(ctx, player, ccName, trxArgs)
 	rt := time.Since(st).Seconds()
 
+	player.Metrics.InFlight.With(player.Metrics.ccLabels(ccLabel)...).Add(-1)
+	player.Metrics.Record(RunRecord{Time: st, Game: player.GameName, Op: InvokeOp,
+		Org: player.OrgID, CC: ccLabel, TrxID: string(r.TransactionID)}, rt, err)
+
 	if err != nil {
-		player.Metrics.
-			With(CCLabel, ccLabel).
-			With(CCFailedLabel, "True").
-			Observe(rt)
+		player.Metrics.Failed.With(player.Metrics.ccLabels(ccLabel)...).Add(1)
+		player.Metrics.Observe(ccLabel, true, rt)
+		player.Metrics.ObservePhases(ccLabel, true, phases)
 		return r, err
 	}
 
-	player.Metrics.
-		With(CCLabel, ccLabel).
-		With(CCFailedLabel, "False").
-		Observe(rt)
+	player.Metrics.Observe(ccLabel, false, rt)
+	player.Metrics.ObservePhases(ccLabel, false, phases)
 
 	return r, nil
 }
 
-func invokeGameChaincode(player *TFCClient, ccName string, protoArgs []byte) (channel.Response, error) {
+func invokeGameChaincode(ctx context.Context, player *TFCClient, ccName string, protoArgs []byte) (channel.Response, TrxPhases, error) {
 
 	log.Printf("Invoking game chaincode %s for client %v", ccName, player)
 
-	response, err := player.ChannelClient.Execute(
+	response, phases, err := player.Ledger.Execute(ctx, player,
 		channel.Request{
 			ChaincodeID: ccName,
 			Fcn:         "publish",
-			Args:        [][]byte{protoArgs}},
-		channel.WithRetry(retry.DefaultChannelOpts))
+			Args:        [][]byte{protoArgs}})
 
 	if err != nil {
-		return channel.Response{}, fmt.Errorf("Failed to invoke cc: %s", err)
-	}
-
-	return response, nil
-}
-
-func recordFailure() {
-
-	if r := recover(); r != nil {
-		fmt.Println("Recovered from ops failure", r)
-		GetPlayerMetrics().
-			With(CCLabel, "Operations").
-			With(CCFailedLabel, "True").
-			Observe(1)
+		// Keep the SDK status, it classifies the failure, and the response,
+		// which holds the ID of the failed transaction
+		return response, phases, errors.WithMessage(err, "Failed to invoke cc")
 	}
 
+	return response, phases, nil
 }
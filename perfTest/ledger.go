@@ -0,0 +1,145 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+)
+
+// Ledger is the backend a TFCClient plays its games on. It covers everything
+// the executors need from the network: connecting the players, creating and
+// joining the game channel, deploying chaincode and executing transactions.
+// All calls give up once their context is done.
+type Ledger interface {
+	// Connect creates one client per org, all attached to this ledger and to
+	// the run config, on the network of cfg.
+	Connect(ctx context.Context, cfg *RunConfig, gameName string, chanOrgs []string) ([]*TFCClient, error)
+	// CreateChannel creates the channel, signed by all the players.
+	CreateChannel(ctx context.Context, players []*TFCClient, chanName string) error
+	// JoinChannel joins the player's peer to the channel and prepares the
+	// player to execute transactions on it.
+	JoinChannel(ctx context.Context, player *TFCClient, chanName string) error
+	// InstallCC installs the chaincode on all the peers of all players.
+	InstallCC(ctx context.Context, players []*TFCClient, ccReq resmgmt.InstallCCRequest) error
+	// InstantiateCC instantiates the chaincode on the channel, targeting the
+	// peers of all players.
+	InstantiateCC(ctx context.Context, players []*TFCClient, chanName string, ccReq resmgmt.InstantiateCCRequest) error
+	// Execute submits a transaction on behalf of the player to the peers
+	// picked by the endorsement of the game, and reports the duration of its
+	// phases.
+	Execute(ctx context.Context, player *TFCClient, req channel.Request) (channel.Response, TrxPhases, error)
+	// Close releases the resources held for the player.
+	Close(player *TFCClient)
+}
+
+// fabricLedger runs the games on a Hyperledger Fabric network through the
+// fabric-sdk-go clients stored on each TFCClient.
+type fabricLedger struct{}
+
+func (fabricLedger) Connect(ctx context.Context, cfg *RunConfig, gameName string, chanOrgs []string) ([]*TFCClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cfgPath, err := generateChannelArtifacts(cfg, gameName, chanOrgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return generatePlayers(cfg, cfgPath, chanOrgs, gameName)
+}
+
+func (fabricLedger) CreateChannel(ctx context.Context, players []*TFCClient, chanName string) error {
+	p1 := players[0]
+	chanTxPath := path.Join(p1.FabricCfgPath, chanName+".tx")
+	signatures := getSignatures(players)
+	return createChannel(ctx, p1, signatures, chanName, chanTxPath)
+}
+
+func (fabricLedger) JoinChannel(ctx context.Context, player *TFCClient, chanName string) error {
+	err := joinGame(ctx, player, chanName)
+	if err != nil {
+		return fmt.Errorf("could not join game channel: %s", err)
+	}
+	err = updateAnchorPeers(ctx, player, chanName)
+	if err != nil {
+		return fmt.Errorf("could not update anchor peers: %s", err)
+	}
+
+	err = updateChannelClient(player, chanName)
+	if err != nil {
+		return fmt.Errorf("could not update channel client: %s", err)
+	}
+	return nil
+}
+
+func (fabricLedger) InstallCC(ctx context.Context, players []*TFCClient, ccReq resmgmt.InstallCCRequest) error {
+	if ccReq.Package == nil {
+		ccPkg, err := createCC(ccReq.Path)
+		if err != nil {
+			return fmt.Errorf("could not create cc package: %s", err)
+		}
+		ccReq.Package = ccPkg
+	}
+
+	for _, player := range players {
+		_, err := player.ResMgmt.InstallCC(ccReq,
+			resmgmt.WithParentContext(ctx),
+			resmgmt.WithRetry(retry.DefaultResMgmtOpts),
+			resmgmt.WithTargetEndpoints(player.Peers...))
+		if err != nil {
+			return fmt.Errorf("failed to install cc: %s", err)
+		}
+	}
+	return nil
+}
+
+func (fabricLedger) InstantiateCC(ctx context.Context, players []*TFCClient, chanName string, ccReq resmgmt.InstantiateCCRequest) error {
+	teps := make([]string, len(players))
+	for i, p := range players {
+		teps[i] = p.PeerEndpoint
+	}
+
+	p1 := players[0]
+	_, err := p1.ResMgmt.InstantiateCC(
+		chanName,
+		ccReq,
+		resmgmt.WithParentContext(ctx),
+		resmgmt.WithRetry(retry.DefaultResMgmtOpts),
+		resmgmt.WithTargetEndpoints(teps...),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate cc: %s", err)
+	}
+	return nil
+}
+
+func (fabricLedger) Execute(ctx context.Context, player *TFCClient, req channel.Request) (channel.Response, TrxPhases, error) {
+	opts := []channel.RequestOption{
+		channel.WithParentContext(ctx),
+		channel.WithRetry(retry.DefaultChannelOpts),
+	}
+	targets := player.endorsers.targets()
+	if len(targets) > 0 {
+		opts = append(opts, channel.WithTargetEndpoints(targets...))
+	}
+
+	timer := &phaseTimer{}
+	r, err := player.ChannelClient.InvokeHandler(newTimedExecuteHandler(timer), req, opts...)
+	phases := timer.phases()
+	if phases.Endorsement > 0 {
+		player.endorsers.observe(targets, phases.Endorsement)
+	}
+	if r.TransactionID == "" {
+		r.TransactionID = timer.transactionID()
+	}
+	return r, phases, err
+}
+
+func (fabricLedger) Close(player *TFCClient) {
+	player.SDK.Close()
+}
@@ -1,9 +1,12 @@
 package tfc
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"math"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-kit/kit/metrics/prometheus"
 	promClient "github.com/prometheus/client_golang/prometheus"
@@ -12,36 +15,352 @@ import (
 
 var CCLabel = "CC"
 var CCFailedLabel = "Failed"
+var PhaseLabel = "Phase"
+var StageLabel = "Stage"
+var OrgLabel = "Org"
 
-var promeHist *prometheus.Histogram
+// BucketConfig describes the bucket layout of the runtime histogram. Kind is
+// one of:
+//   - linear: Count buckets, starting at Start, Width apart
+//   - exponential: Count buckets, starting at Start, each Factor times the previous
+//   - explicit: the upper bounds listed in Buckets
+//
+// The +Inf bucket is always added.
+type BucketConfig struct {
+	Kind    string    `yaml:"kind"`
+	Start   float64   `yaml:"start"`
+	Width   float64   `yaml:"width"`
+	Factor  float64   `yaml:"factor"`
+	Count   int       `yaml:"count"`
+	Buckets []float64 `yaml:"buckets"`
+}
+
+// Layout returns the upper bounds of the buckets.
+func (bc BucketConfig) Layout() (buckets []float64, err error) {
+	// the prometheus client panics on invalid layouts
+	defer func() {
+		if r := recover(); r != nil {
+			buckets, err = nil, fmt.Errorf("invalid %s bucket layout: %v", bc.Kind, r)
+		}
+	}()
+
+	switch bc.Kind {
+	case "linear":
+		return promClient.LinearBuckets(bc.Start, bc.Width, bc.Count), nil
+	case "exponential":
+		return promClient.ExponentialBuckets(bc.Start, bc.Factor, bc.Count), nil
+	case "explicit":
+		if len(bc.Buckets) == 0 {
+			return nil, fmt.Errorf("explicit bucket layout needs at least one bucket")
+		}
+		for i := 1; i < len(bc.Buckets); i++ {
+			if bc.Buckets[i] <= bc.Buckets[i-1] {
+				return nil, fmt.Errorf("explicit buckets must be in increasing order, got %v", bc.Buckets)
+			}
+		}
+		return bc.Buckets, nil
+	}
+	return nil, fmt.Errorf("unknown bucket layout %q", bc.Kind)
+}
+
+// MetricsConfig configures the metrics exposed by the players.
+type MetricsConfig struct {
+	Namespace string       `yaml:"namespace"`
+	Subsystem string       `yaml:"subsystem"`
+	Buckets   BucketConfig `yaml:"buckets"`
+	// Quantiles maps the quantiles of the runtime summary to their allowed error.
+	Quantiles map[float64]float64 `yaml:"quantiles"`
+}
+
+// DefaultMetricsConfig returns buckets from 50ms up to ~25s, and the median,
+// 90th and 99th runtime percentiles.
+func DefaultMetricsConfig() MetricsConfig {
+	return MetricsConfig{
+		Namespace: "tfc",
+		Subsystem: "testing",
+		Buckets: BucketConfig{
+			Kind:   "exponential",
+			Start:  0.05,
+			Factor: 2,
+			Count:  10,
+		},
+		Quantiles: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	}
+}
+
+// PlayerMetrics holds the metrics observed by the players: the runtime of
+// chaincode invocations and operations, the runtime of each transaction
+// phase, the number of submitted and failed transactions, the number of
+// invocations in flight, and the number of games each org plays. All metrics
+// are labelled with the load stage they were observed in.
+type PlayerMetrics struct {
+	Runtime        *prometheus.Histogram
+	RuntimeSummary *prometheus.Summary
+	PhaseRuntime   *prometheus.Histogram
+	Submitted      *prometheus.Counter
+	Failed         *prometheus.Counter
+	InFlight       *prometheus.Gauge
+	OrgGames       *prometheus.Gauge
+	// RunLog, if set, receives a record for every measured operation.
+	RunLog *RunLog
+
+	stage      string
+	collectors []promClient.Collector
+}
+
+// NewPlayerMetrics creates the player metrics described by cfg. The metrics
+// are not registered.
+func NewPlayerMetrics(cfg MetricsConfig) (*PlayerMetrics, error) {
+	buckets, err := cfg.Buckets.Layout()
+	if err != nil {
+		return nil, err
+	}
+
+	runtime := promClient.NewHistogramVec(
+		promClient.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "runtime",
+			Help:      "Runtime of chaincode invocations and operations, in seconds.",
+			Buckets:   buckets,
+		}, []string{CCLabel, CCFailedLabel, StageLabel})
+
+	runtimeSummary := promClient.NewSummaryVec(
+		promClient.SummaryOpts{
+			Namespace:  cfg.Namespace,
+			Subsystem:  cfg.Subsystem,
+			Name:       "runtime_summary",
+			Help:       "Runtime quantiles of chaincode invocations and operations, in seconds.",
+			Objectives: cfg.Quantiles,
+		}, []string{CCLabel, CCFailedLabel, StageLabel})
+
+	phaseRuntime := promClient.NewHistogramVec(
+		promClient.HistogramOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "phase_runtime",
+			Help:      "Runtime of the endorsement and commit phases of chaincode invocations, in seconds.",
+			Buckets:   buckets,
+		}, []string{CCLabel, CCFailedLabel, PhaseLabel, StageLabel})
+
+	submitted := promClient.NewCounterVec(
+		promClient.CounterOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "submitted_trx_total",
+			Help:      "Number of submitted chaincode invocations.",
+		}, []string{CCLabel, StageLabel})
+
+	failed := promClient.NewCounterVec(
+		promClient.CounterOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "failed_trx_total",
+			Help:      "Number of failed chaincode invocations.",
+		}, []string{CCLabel, StageLabel})
+
+	inFlight := promClient.NewGaugeVec(
+		promClient.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "inflight_trx",
+			Help:      "Number of chaincode invocations waiting for a response.",
+		}, []string{CCLabel, StageLabel})
+
+	orgGames := promClient.NewGaugeVec(
+		promClient.GaugeOpts{
+			Namespace: cfg.Namespace,
+			Subsystem: cfg.Subsystem,
+			Name:      "org_games",
+			Help:      "Number of games each org is playing.",
+		}, []string{OrgLabel, StageLabel})
+
+	return &PlayerMetrics{
+		Runtime:        prometheus.NewHistogram(runtime),
+		RuntimeSummary: prometheus.NewSummary(runtimeSummary),
+		PhaseRuntime:   prometheus.NewHistogram(phaseRuntime),
+		Submitted:      prometheus.NewCounter(submitted),
+		Failed:         prometheus.NewCounter(failed),
+		InFlight:       prometheus.NewGauge(inFlight),
+		OrgGames:       prometheus.NewGauge(orgGames),
+		collectors:     []promClient.Collector{runtime, runtimeSummary, phaseRuntime, submitted, failed, inFlight, orgGames},
+	}, nil
+}
+
+// Register registers all player metrics with the given registerer.
+func (pm *PlayerMetrics) Register(reg promClient.Registerer) error {
+	for _, c := range pm.collectors {
+		err := reg.Register(c)
+		if err != nil {
+			return fmt.Errorf("could not register metrics: %s", err)
+		}
+	}
+	return nil
+}
+
+// WithStage returns the metrics labelled with the stage. The returned metrics
+// share the collectors and the run log with pm.
+func (pm *PlayerMetrics) WithStage(stage string) *PlayerMetrics {
+	staged := *pm
+	staged.stage = stage
+	return &staged
+}
+
+// ccLabels returns the label values of the counters and gauges of the
+// chaincode.
+func (pm *PlayerMetrics) ccLabels(ccLabel string) []string {
+	return []string{CCLabel, ccLabel, StageLabel, pm.stage}
+}
 
-func startProme() func() {
+// Observe records the runtime, in seconds, of a chaincode invocation or
+// operation.
+func (pm *PlayerMetrics) Observe(ccLabel string, failed bool, rt float64) {
+	failedLabel := "False"
+	if failed {
+		failedLabel = "True"
+	}
+
+	pm.Runtime.With(CCLabel, ccLabel, CCFailedLabel, failedLabel, StageLabel, pm.stage).Observe(rt)
+	pm.RuntimeSummary.With(CCLabel, ccLabel, CCFailedLabel, failedLabel, StageLabel, pm.stage).Observe(rt)
+}
+
+// ObservePhases records the runtime of the phases a chaincode invocation went
+// through.
+func (pm *PlayerMetrics) ObservePhases(ccLabel string, failed bool, phases TrxPhases) {
+	failedLabel := "False"
+	if failed {
+		failedLabel = "True"
+	}
+
+	for phase, rt := range map[string]time.Duration{
+		EndorsementPhase: phases.Endorsement,
+		CommitPhase:      phases.Commit,
+		TotalPhase:       phases.Total,
+	} {
+		if rt == 0 {
+			continue
+		}
+		pm.PhaseRuntime.
+			With(CCLabel, ccLabel, CCFailedLabel, failedLabel, PhaseLabel, phase, StageLabel, pm.stage).
+			Observe(rt.Seconds())
+	}
+}
+
+// ObserveScheduled records the runtime, in seconds, of an open-loop script
+// step from the time it was scheduled at.
+func (pm *PlayerMetrics) ObserveScheduled(ccLabel string, failed bool, rt float64) {
+	failedLabel := "False"
+	if failed {
+		failedLabel = "True"
+	}
+
+	pm.PhaseRuntime.
+		With(CCLabel, ccLabel, CCFailedLabel, failedLabel, PhaseLabel, ScheduledPhase, StageLabel, pm.stage).
+		Observe(rt)
+}
+
+// ObserveOrgGames records the number of games the org is playing.
+func (pm *PlayerMetrics) ObserveOrgGames(org string, games int) {
+	pm.OrgGames.With(OrgLabel, org, StageLabel, pm.stage).Set(float64(games))
+}
+
+// Record completes the record with the latency, in seconds, and the outcome
+// of the operation, and appends it to the run log.
+func (pm *PlayerMetrics) Record(rec RunRecord, rt float64, err error) {
+	if pm.RunLog == nil {
+		return
+	}
+
+	rec.Stage = pm.stage
+	rec.Latency = rt
+	rec.Success = err == nil
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	logErr := pm.RunLog.Record(rec)
+	if logErr != nil {
+		log.Printf("Could not write run log record: %s", logErr)
+	}
+}
+
+// MetricsServer serves the player metrics over HTTP, from its own registry
+// and mux, such that several servers can run in the same process.
+type MetricsServer struct {
+	addr     string
+	registry *promClient.Registry
+	metrics  *PlayerMetrics
+	srv      *http.Server
+	listener net.Listener
+}
+
+// NewMetricsServer creates a server exposing the metrics described by cfg on
+// addr, under /metrics. Use an addr with port 0 to pick a free port.
+func NewMetricsServer(addr string, cfg MetricsConfig) (*MetricsServer, error) {
+	metrics, err := NewPlayerMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := promClient.NewRegistry()
+	err = metrics.Register(registry)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return &MetricsServer{
+		addr:     addr,
+		registry: registry,
+		metrics:  metrics,
+		srv:      &http.Server{Addr: addr, Handler: mux},
+	}, nil
+}
+
+// Start starts serving the metrics in the background.
+func (ms *MetricsServer) Start() error {
+	l, err := net.Listen("tcp", ms.addr)
+	if err != nil {
+		return fmt.Errorf("could not start metrics server: %s", err)
+	}
+	ms.listener = l
 
-	srv := http.Server{Addr: ":9009"}
-	http.Handle("/metrics", promhttp.Handler())
 	go func() {
-		httpError := srv.ListenAndServe()
-		if httpError != nil {
+		httpError := ms.srv.Serve(l)
+		if httpError != nil && httpError != http.ErrServerClosed {
 			log.Println("While serving HTTP: ", httpError)
-			srv.Shutdown(nil)
 		}
 	}()
+	return nil
+}
 
-	promeHist = prometheus.NewHistogramFrom(
-		promClient.HistogramOpts{
-			Namespace: "tfc",
-			Subsystem: "testing",
-			Name:      "runtime",
-			Help:      "No help",
-			Buckets:   []float64{2.5, math.Inf(1)},
-		}, []string{CCLabel, CCFailedLabel})
+// Shutdown stops serving the metrics. The listener is closed before
+// returning, even if the server did not start serving yet, so the address can
+// be reused right away.
+func (ms *MetricsServer) Shutdown() error {
+	err := ms.srv.Shutdown(context.Background())
+	if ms.listener != nil {
+		ms.listener.Close()
+	}
+	return err
+}
 
-	return func() {
-		srv.Shutdown(nil)
+// Addr returns the address the server listens on, once started.
+func (ms *MetricsServer) Addr() string {
+	if ms.listener == nil {
+		return ms.addr
 	}
+	return ms.listener.Addr().String()
 }
 
-func GetPlayerMetrics() *prometheus.Histogram {
+// Registry returns the registry holding the served metrics.
+func (ms *MetricsServer) Registry() *promClient.Registry {
+	return ms.registry
+}
 
-	return promeHist
+// Metrics returns the player metrics, to be passed to the game clients.
+func (ms *MetricsServer) Metrics() *PlayerMetrics {
+	return ms.metrics
 }
@@ -0,0 +1,90 @@
+package tfc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketLayouts(t *testing.T) {
+	linear, err := BucketConfig{Kind: "linear", Start: 1, Width: 0.5, Count: 3}.Layout()
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 1.5, 2}, linear)
+
+	exponential, err := BucketConfig{Kind: "exponential", Start: 0.1, Factor: 10, Count: 3}.Layout()
+	require.NoError(t, err)
+	require.InDeltaSlice(t, []float64{0.1, 1, 10}, exponential, 1e-9)
+
+	explicit, err := BucketConfig{Kind: "explicit", Buckets: []float64{0.5, 2.5, 10}}.Layout()
+	require.NoError(t, err)
+	require.Equal(t, []float64{0.5, 2.5, 10}, explicit)
+
+	invalid := []BucketConfig{
+		{Kind: "quadratic"},
+		{Kind: "linear", Start: 1, Width: 1, Count: 0},
+		{Kind: "exponential", Start: 1, Factor: 0.5, Count: 3},
+		{Kind: "explicit"},
+		{Kind: "explicit", Buckets: []float64{2.5, 0.5}},
+	}
+	for _, bc := range invalid {
+		_, err := bc.Layout()
+		require.Error(t, err, "expected %v to be rejected", bc)
+	}
+}
+
+func TestPlayerMetrics(t *testing.T) {
+	ms, err := NewMetricsServer("127.0.0.1:0", DefaultMetricsConfig())
+	require.NoError(t, err, "could not create metrics server")
+
+	players, err := NewSimLedger().Connect(context.Background(), DefaultRunConfig(), "metrics1", []string{Player1})
+	require.NoError(t, err, "could not connect players")
+	players[0].Metrics = ms.Metrics()
+
+	// the channel does not exist, so the invocation fails
+	_, err = invokeAndMeasure(context.Background(), players[0], "echo", "echo", []byte("move"))
+	require.Error(t, err)
+
+	families, err := ms.Registry().Gather()
+	require.NoError(t, err)
+	values := map[string]*dto.Metric{}
+	for _, f := range families {
+		values[f.GetName()] = f.GetMetric()[0]
+	}
+
+	require.Equal(t, float64(1), values["tfc_testing_submitted_trx_total"].GetCounter().GetValue())
+	require.Equal(t, float64(1), values["tfc_testing_failed_trx_total"].GetCounter().GetValue())
+	require.Equal(t, float64(0), values["tfc_testing_inflight_trx"].GetGauge().GetValue())
+	require.Equal(t, uint64(1), values["tfc_testing_runtime"].GetHistogram().GetSampleCount())
+	require.Len(t, values["tfc_testing_runtime"].GetHistogram().GetBucket(), 10)
+	require.Len(t, values["tfc_testing_runtime_summary"].GetSummary().GetQuantile(), 3)
+}
+
+func TestMetricsServers(t *testing.T) {
+	servers := []*MetricsServer{}
+	for i := 0; i < 2; i++ {
+		ms, err := NewMetricsServer("127.0.0.1:0", DefaultMetricsConfig())
+		require.NoError(t, err, "could not create metrics server")
+		require.NoError(t, ms.Start(), "could not start metrics server")
+		defer ms.Shutdown()
+
+		servers = append(servers, ms)
+	}
+
+	servers[0].Metrics().Observe("ttt", false, 1)
+
+	for i, ms := range servers {
+		resp, err := http.Get("http://" + ms.Addr() + "/metrics")
+		require.NoError(t, err, "could not scrape metrics")
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		require.Equal(t, i == 0, strings.Contains(string(body), `tfc_testing_runtime_count{CC="ttt",Failed="False",Stage=""} 1`),
+			"expected only the first server to observe the runtime")
+	}
+}
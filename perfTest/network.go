@@ -0,0 +1,320 @@
+package tfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// NetworkPeer is a peer of an org. Port is the port the peer listens on
+// inside the network, and HostPort the port it is published on the local
+// host.
+type NetworkPeer struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	HostPort int    `yaml:"hostPort"`
+}
+
+// NetworkOrg is a player org of the network. Only the Name is required, the
+// rest defaults to the layout of the tfc network: the org Player1 has the
+// MSP Player1MSP, the domain player1.tfc.com, the peers peer0.player1.tfc.com
+// onwards and the CA ca.player1.tfc.com.
+type NetworkOrg struct {
+	Name   string `yaml:"name"`
+	MSPID  string `yaml:"mspID"`
+	Domain string `yaml:"domain"`
+	// CryptoPath holds the MSP and TLS material of the org. It defaults to
+	// the domain under the peerOrganizations of the network.
+	CryptoPath string `yaml:"cryptoPath"`
+	// Peers default to the PeersPerOrg of the network, listening on port
+	// 7051. The m-th peer of the n-th org defaults to the host port
+	// 7051 + 1000 * n + 100 * m. The first peer is the anchor peer.
+	Peers  []NetworkPeer `yaml:"peers"`
+	CA     string        `yaml:"ca"`
+	CAName string        `yaml:"caName"`
+	CAURL  string        `yaml:"caURL"`
+}
+
+// NetworkOrderer is an orderer of the network. Host defaults to the orderer
+// of the network domain, and Port and HostPort to 7050.
+type NetworkOrderer struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	HostPort int    `yaml:"hostPort"`
+}
+
+// Network describes the topology of the network: its orderers, and the
+// player orgs the games are played by. It is the single source of the
+// endpoints, identities and crypto material of the games, for example:
+//
+//	domain: tfc.com
+//	cryptoPath: /srv/tfc/crypto-config
+//	orderers: [{host: orderer.tfc.com, port: 7050}]
+//	orgs:
+//	  - name: Player1
+//	  - name: Player2
+//	  - {name: Player3, peers: [{host: peer0.player3.tfc.com, hostPort: 9051}]}
+//	orgSets:
+//	  - [Player1, Player2, Player3]
+//	  - [Player3, Player2, Player1]
+type Network struct {
+	// Domain is the domain of the orderers, and the parent domain of the
+	// orgs. It defaults to tfc.com.
+	Domain string `yaml:"domain"`
+	// CryptoPath holds the crypto material of the network, as generated by
+	// cryptogen. It defaults to $SCFIXTURES/tfc/crypto-config.
+	CryptoPath string `yaml:"cryptoPath"`
+	// Admin manages the channels and chaincodes of every org, and User
+	// submits its transactions. They default to Admin and User1.
+	Admin string `yaml:"admin"`
+	User  string `yaml:"user"`
+	// OrdererMSPID defaults to OrdererMSP.
+	OrdererMSPID string           `yaml:"ordererMSPID"`
+	Orderers     []NetworkOrderer `yaml:"orderers"`
+	// KafkaBrokers order the transactions. They default to the kafka host of
+	// the network domain.
+	KafkaBrokers []string `yaml:"kafkaBrokers"`
+	// PeersPerOrg is the number of peers of the orgs which do not list their
+	// peers. It defaults to 1.
+	PeersPerOrg int          `yaml:"peersPerOrg"`
+	Orgs        []NetworkOrg `yaml:"orgs"`
+	// OrgSets are the orgs of the games, unless the experiment picks its
+	// own. They default to each org with the two orgs following it.
+	OrgSets [][]string `yaml:"orgSets"`
+}
+
+// Player1 to Player5 are the orgs of the default network.
+const (
+	Player1 = "Player1"
+	Player2 = "Player2"
+	Player3 = "Player3"
+	Player4 = "Player4"
+	Player5 = "Player5"
+)
+
+// DefaultNetwork is the tfc network of five players.
+func DefaultNetwork() Network {
+	return Network{
+		Orgs: []NetworkOrg{{Name: Player1}, {Name: Player2}, {Name: Player3}, {Name: Player4}, {Name: Player5}},
+		OrgSets: [][]string{
+			{Player1, Player2, Player3},
+			{Player3, Player5, Player4},
+			{Player4, Player1, Player2},
+			{Player2, Player3, Player5},
+			{Player5, Player4, Player1},
+			{Player2, Player3, Player1},
+			{Player3, Player5, Player2},
+			{Player5, Player1, Player4},
+		},
+	}.withDefaults()
+}
+
+// LoadNetwork reads and validates a network description.
+func LoadNetwork(networkPath string) (Network, error) {
+	data, err := ioutil.ReadFile(networkPath)
+	if err != nil {
+		return Network{}, fmt.Errorf("could not read network description: %s", err)
+	}
+
+	n := Network{}
+	err = yaml.UnmarshalStrict(data, &n)
+	if err != nil {
+		return Network{}, fmt.Errorf("could not parse network description %s: %s", networkPath, err)
+	}
+	n = n.withDefaults()
+	if err := n.Validate(); err != nil {
+		return Network{}, fmt.Errorf("invalid network description %s: %s", networkPath, err)
+	}
+	return n, nil
+}
+
+// withDefaults fills in the defaults of the network, its orgs and org sets.
+func (n Network) withDefaults() Network {
+	if n.Domain == "" {
+		n.Domain = "tfc.com"
+	}
+	if n.CryptoPath == "" {
+		n.CryptoPath = path.Join(scfixturesPath, "crypto-config")
+	}
+	if n.Admin == "" {
+		n.Admin = "Admin"
+	}
+	if n.User == "" {
+		n.User = "User1"
+	}
+	if n.OrdererMSPID == "" {
+		n.OrdererMSPID = "OrdererMSP"
+	}
+	if len(n.Orderers) == 0 {
+		n.Orderers = []NetworkOrderer{{}}
+	}
+	orderers := make([]NetworkOrderer, len(n.Orderers))
+	for i, o := range n.Orderers {
+		if o.Host == "" {
+			o.Host = "orderer." + n.Domain
+		}
+		if o.Port == 0 {
+			o.Port = 7050
+		}
+		if o.HostPort == 0 {
+			o.HostPort = o.Port
+		}
+		orderers[i] = o
+	}
+	n.Orderers = orderers
+	if len(n.KafkaBrokers) == 0 {
+		n.KafkaBrokers = []string{"kafka." + n.Domain + ":9092"}
+	}
+	if n.PeersPerOrg == 0 {
+		n.PeersPerOrg = 1
+	}
+
+	orgs := make([]NetworkOrg, len(n.Orgs))
+	for i, o := range n.Orgs {
+		lowName := strings.ToLower(o.Name)
+		if o.MSPID == "" {
+			o.MSPID = o.Name + "MSP"
+		}
+		if o.Domain == "" {
+			o.Domain = lowName + "." + n.Domain
+		}
+		if o.CryptoPath == "" {
+			o.CryptoPath = path.Join(n.CryptoPath, "peerOrganizations", o.Domain)
+		}
+		if len(o.Peers) == 0 && n.PeersPerOrg > 0 {
+			o.Peers = make([]NetworkPeer, n.PeersPerOrg)
+		}
+		peers := make([]NetworkPeer, len(o.Peers))
+		for j, p := range o.Peers {
+			if p.Host == "" {
+				p.Host = fmt.Sprintf("peer%d.%s", j, o.Domain)
+			}
+			if p.Port == 0 {
+				p.Port = 7051
+			}
+			if p.HostPort == 0 {
+				p.HostPort = 7051 + 1000*i + 100*j
+			}
+			peers[j] = p
+		}
+		o.Peers = peers
+		if o.CA == "" {
+			o.CA = "ca." + o.Domain
+		}
+		if o.CAName == "" {
+			o.CAName = "ca-" + lowName
+		}
+		if o.CAURL == "" {
+			o.CAURL = "https://" + o.CA + ":7054"
+		}
+		orgs[i] = o
+	}
+	n.Orgs = orgs
+
+	orgSets := n.OrgSets
+	if len(orgSets) == 0 && len(orgs) < 3 {
+		orgSets = [][]string{{}}
+		for _, o := range orgs {
+			orgSets[0] = append(orgSets[0], o.Name)
+		}
+	} else if len(orgSets) == 0 {
+		for i := range orgs {
+			orgSets = append(orgSets, []string{orgs[i].Name,
+				orgs[(i+1)%len(orgs)].Name, orgs[(i+2)%len(orgs)].Name})
+		}
+	}
+	n.OrgSets = orgSets
+	return n
+}
+
+// Validate checks that the orgs and orderers are distinct, and that the org
+// sets are made of the orgs.
+func (n Network) Validate() error {
+	if len(n.Orgs) == 0 {
+		return fmt.Errorf("network has no orgs")
+	}
+	names, mspIDs, ports := map[string]bool{}, map[string]bool{}, map[int]bool{}
+	for _, o := range n.Orderers {
+		if ports[o.HostPort] {
+			return fmt.Errorf("orderer %s uses the host port %d of another orderer", o.Host, o.HostPort)
+		}
+		ports[o.HostPort] = true
+	}
+	mspIDs[n.OrdererMSPID] = true
+	for _, o := range n.Orgs {
+		if o.Name == "" {
+			return fmt.Errorf("network has an org without a name")
+		}
+		if names[o.Name] || mspIDs[o.MSPID] {
+			return fmt.Errorf("duplicate org %s with MSP %s", o.Name, o.MSPID)
+		}
+		if len(o.Peers) == 0 {
+			return fmt.Errorf("org %s has no peers", o.Name)
+		}
+		for _, p := range o.Peers {
+			if ports[p.HostPort] {
+				return fmt.Errorf("peer %s uses the host port %d of another peer or orderer", p.Host, p.HostPort)
+			}
+			ports[p.HostPort] = true
+		}
+		names[o.Name], mspIDs[o.MSPID] = true, true
+	}
+
+	for _, orgs := range n.OrgSets {
+		if len(orgs) == 0 {
+			return fmt.Errorf("network has an empty org set")
+		}
+		for _, org := range orgs {
+			if !names[org] {
+				return fmt.Errorf("org set %v has the unknown org %s", orgs, org)
+			}
+		}
+	}
+	return nil
+}
+
+// Org returns the org with the name.
+func (n Network) Org(name string) (NetworkOrg, error) {
+	for _, o := range n.Orgs {
+		if o.Name == name {
+			return o, nil
+		}
+	}
+	return NetworkOrg{}, fmt.Errorf("org %s is not part of the network", name)
+}
+
+// channelOrgs returns the orgs with the names.
+func (n Network) channelOrgs(names []string) ([]NetworkOrg, error) {
+	orgs := []NetworkOrg{}
+	for _, name := range names {
+		o, err := n.Org(name)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, nil
+}
+
+// OrdererCryptoPath holds the MSP and TLS material of the orderers.
+func (n Network) OrdererCryptoPath() string {
+	return path.Join(n.CryptoPath, "ordererOrganizations", n.Domain)
+}
+
+// ordererEndpoint is the orderer the channels are created and joined
+// through.
+func (n Network) ordererEndpoint() string {
+	return n.Orderers[0].Host
+}
+
+// peerHosts returns the host names of the peers of the org.
+func (o NetworkOrg) peerHosts() []string {
+	hosts := []string{}
+	for _, p := range o.Peers {
+		hosts = append(hosts, p.Host)
+	}
+	return hosts
+}
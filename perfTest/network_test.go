@@ -0,0 +1,148 @@
+package tfc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestDefaultNetwork(t *testing.T) {
+	n := DefaultNetwork()
+	require.NoError(t, n.Validate())
+	require.Len(t, n.Orgs, 5)
+
+	org, err := n.Org(Player2)
+	require.NoError(t, err)
+	require.Equal(t, NetworkOrg{Name: Player2, MSPID: "Player2MSP", Domain: "player2.tfc.com",
+		CryptoPath: filepath.Join(scfixturesPath, "crypto-config", "peerOrganizations", "player2.tfc.com"),
+		Peers:      []NetworkPeer{{Host: "peer0.player2.tfc.com", Port: 7051, HostPort: 8051}},
+		CA:         "ca.player2.tfc.com", CAName: "ca-player2", CAURL: "https://ca.player2.tfc.com:7054"}, org)
+
+	_, err = n.Org("Player6")
+	require.Error(t, err, "expected Player6 not to be part of the network")
+
+	require.Equal(t, []NetworkOrderer{{Host: "orderer.tfc.com", Port: 7050, HostPort: 7050}}, n.Orderers)
+	require.Equal(t, "orderer.tfc.com", n.ordererEndpoint())
+	require.Equal(t, filepath.Join(scfixturesPath, "crypto-config", "ordererOrganizations", "tfc.com"),
+		n.OrdererCryptoPath())
+	require.Equal(t, "Admin", n.Admin)
+	require.Equal(t, "User1", n.User)
+}
+
+func writeNetwork(t *testing.T, dir string, nOfOrgs int) string {
+	content := "orgs:\n"
+	for i := 1; i <= nOfOrgs; i++ {
+		content += fmt.Sprintf("  - name: Org%d\n", i)
+	}
+	networkPath := filepath.Join(dir, "network.yaml")
+	require.NoError(t, ioutil.WriteFile(networkPath, []byte(content), 0644))
+	return networkPath
+}
+
+func TestLoadNetwork(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n, err := LoadNetwork(writeNetwork(t, dir, 20))
+	require.NoError(t, err)
+	require.Len(t, n.Orgs, 20)
+	require.Equal(t, 26051, n.Orgs[19].Peers[0].HostPort)
+	require.Len(t, n.OrgSets, 20)
+	require.Equal(t, []string{"Org20", "Org1", "Org2"}, n.OrgSets[19])
+
+	n, err = LoadNetwork(writeNetwork(t, dir, 2))
+	require.NoError(t, err)
+	require.Equal(t, [][]string{{"Org1", "Org2"}}, n.OrgSets)
+
+	networkPath := filepath.Join(dir, "topology.yaml")
+	require.NoError(t, ioutil.WriteFile(networkPath, []byte(`
+domain: example.com
+cryptoPath: /srv/crypto
+admin: Root
+orderers: [{host: orderer0.example.com}, {host: orderer1.example.com, hostPort: 8050}]
+peersPerOrg: 2
+orgs: [{name: Org1}, {name: Org2, domain: second.org, peers: [{host: peer.second.org}]}]
+`), 0644))
+	n, err = LoadNetwork(networkPath)
+	require.NoError(t, err)
+	require.Equal(t, "Root", n.Admin)
+	require.Equal(t, []NetworkOrderer{{Host: "orderer0.example.com", Port: 7050, HostPort: 7050},
+		{Host: "orderer1.example.com", Port: 7050, HostPort: 8050}}, n.Orderers)
+	require.Equal(t, []string{"kafka.example.com:9092"}, n.KafkaBrokers)
+	require.Equal(t, "/srv/crypto/ordererOrganizations/example.com", n.OrdererCryptoPath())
+	require.Equal(t, []NetworkPeer{{Host: "peer0.org1.example.com", Port: 7051, HostPort: 7051},
+		{Host: "peer1.org1.example.com", Port: 7051, HostPort: 7151}}, n.Orgs[0].Peers)
+	require.Equal(t, []string{"peer.second.org"}, n.Orgs[1].peerHosts())
+	require.Equal(t, "/srv/crypto/peerOrganizations/second.org", n.Orgs[1].CryptoPath)
+	require.Equal(t, "ca.second.org", n.Orgs[1].CA)
+}
+
+func TestNetworkRejectsInvalid(t *testing.T) {
+	networks := map[string]Network{
+		"no orgs":         {},
+		"no name":         {Orgs: []NetworkOrg{{MSPID: "OrgMSP"}}},
+		"duplicate org":   {Orgs: []NetworkOrg{{Name: "Org1"}, {Name: "Org1", Peers: []NetworkPeer{{HostPort: 9051}}}}},
+		"duplicate port":  {Orgs: []NetworkOrg{{Name: "Org1"}, {Name: "Org2", Peers: []NetworkPeer{{HostPort: 7051}}}}},
+		"no peers":        {PeersPerOrg: -1, Orgs: []NetworkOrg{{Name: "Org1"}}},
+		"unknown org":     {Orgs: []NetworkOrg{{Name: "Org1"}}, OrgSets: [][]string{{"Org1", "Org2"}}},
+		"empty org set":   {Orgs: []NetworkOrg{{Name: "Org1"}}, OrgSets: [][]string{{}}},
+		"duplicate MSPID": {Orgs: []NetworkOrg{{Name: "Org1", MSPID: "M"}, {Name: "Org2", MSPID: "M"}}},
+		"orderer MSPID":   {Orgs: []NetworkOrg{{Name: "Org1", MSPID: "OrdererMSP"}}},
+		"orderer port": {Orderers: []NetworkOrderer{{Host: "o1"}, {Host: "o2"}},
+			Orgs: []NetworkOrg{{Name: "Org1"}}},
+	}
+	for name, n := range networks {
+		require.Error(t, n.withDefaults().Validate(), "expected %s to be rejected", name)
+	}
+}
+
+func TestNetworkTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "network")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := Network{PeersPerOrg: 2}
+	for i := 1; i <= 7; i++ {
+		n.Orgs = append(n.Orgs, NetworkOrg{Name: fmt.Sprintf("Org%d", i)})
+	}
+	n = n.withDefaults()
+	chanOrgs, err := n.channelOrgs([]string{"Org6", "Org7"})
+	require.NoError(t, err)
+
+	cfgPath := filepath.Join(dir, "Org6Config.yaml")
+	require.NoError(t, executeTemplate("", cfgPath, "pConfig.yaml_template", pConfigData{chanOrgs[0], chanOrgs, n}))
+	data, err := ioutil.ReadFile(cfgPath)
+	require.NoError(t, err)
+
+	clientCfg := struct {
+		Client struct {
+			Organization string
+			CryptoConfig struct{ Path string } `yaml:"cryptoconfig"`
+		}
+		Orderers       map[string]struct{ URL string }
+		Organizations  map[string]interface{}
+		Peers          map[string]struct{ URL string }
+		CAs            map[string]struct{ URL string } `yaml:"certificateAuthorities"`
+		EntityMatchers struct {
+			Peer []struct{ URLSubstitutionExp string } `yaml:"peer"`
+		} `yaml:"entityMatchers"`
+		Channels map[string]struct{ Peers map[string]interface{} }
+	}{}
+	require.NoError(t, yaml.Unmarshal(data, &clientCfg), "could not parse client cfg:\n%s", data)
+	require.Equal(t, "Org6", clientCfg.Client.Organization)
+	require.Len(t, clientCfg.Organizations, 8, "expected the orgs of the network, and the orderer")
+	require.Len(t, clientCfg.Peers, 14)
+	require.Equal(t, "peer1.org7.tfc.com:13151", clientCfg.Peers["peer1.org7.tfc.com"].URL)
+	require.Equal(t, "https://ca.org6.tfc.com:7054", clientCfg.CAs["ca.org6.tfc.com"].URL)
+	require.Len(t, clientCfg.CAs, 2)
+	require.Len(t, clientCfg.EntityMatchers.Peer, 14)
+	require.Len(t, clientCfg.Channels["_default"].Peers, 4)
+	require.Equal(t, "orderer.tfc.com:7050", clientCfg.Orderers["orderer.tfc.com"].URL)
+	require.Equal(t, n.CryptoPath+"/", clientCfg.Client.CryptoConfig.Path)
+}
@@ -0,0 +1,378 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+)
+
+// LoadStage holds an arrival rate, in transactions per second, for Duration.
+// With Ramp, the rate changes linearly from the rate of the previous stage,
+// or from 0 for the first stage, to Rate.
+type LoadStage struct {
+	Duration time.Duration `yaml:"duration"`
+	Rate     float64       `yaml:"rate"`
+	Ramp     bool          `yaml:"ramp"`
+}
+
+// OpenLoad describes an open-loop load: transactions are issued at the
+// arrival rate of the stages, whether or not the earlier ones completed.
+// Arrivals is one of:
+//   - constant: the transactions are evenly spaced
+//   - poisson: the gaps between transactions are exponentially distributed
+//
+// Each transaction is the next script step of one of Games concurrently
+// played games. Games are replaced by new ones once their script is played,
+// or one of their steps failed.
+type OpenLoad struct {
+	Arrivals string      `yaml:"arrivals"`
+	Stages   []LoadStage `yaml:"stages"`
+	Games    int         `yaml:"games"`
+	// Game is the built-in script of the games: ttt or tfc.
+	Game string `yaml:"game"`
+	// Script is the path of a game script definition, used instead of Game.
+	// The alliances of the script are not created.
+	Script string `yaml:"script"`
+	// Scheduling leases the org sets of the network to the games. All
+	// games are bootstrapped before the load starts, so the exclusive policy,
+	// which could wait forever for the orgs of the other games, is not
+	// supported.
+	Scheduling OrgScheduling `yaml:"scheduling"`
+}
+
+// DefaultOpenLoad ramps Poisson arrivals on 4 TTT games up to 5, and then up
+// to 20 transactions per second, holding each rate for a minute.
+func DefaultOpenLoad() OpenLoad {
+	return OpenLoad{
+		Arrivals: "poisson",
+		Stages: []LoadStage{
+			{Duration: 30 * time.Second, Rate: 5, Ramp: true},
+			{Duration: time.Minute, Rate: 5},
+			{Duration: 30 * time.Second, Rate: 20, Ramp: true},
+			{Duration: time.Minute, Rate: 20},
+		},
+		Games: 4,
+		Game:  "ttt",
+	}
+}
+
+// Validate checks that the load can be generated.
+func (ol OpenLoad) Validate() error {
+	if ol.Arrivals != "constant" && ol.Arrivals != "poisson" {
+		return fmt.Errorf("unknown arrivals %q, expected constant or poisson", ol.Arrivals)
+	}
+	if len(ol.Stages) == 0 {
+		return fmt.Errorf("open load has no stages")
+	}
+	for i, st := range ol.Stages {
+		if st.Duration <= 0 {
+			return fmt.Errorf("stage %d needs a positive duration", i)
+		}
+		if st.Rate < 0 {
+			return fmt.Errorf("stage %d can not have a negative rate", i)
+		}
+	}
+	if ol.Games < 1 {
+		return fmt.Errorf("open load needs at least one game, got %d", ol.Games)
+	}
+	if ol.Script == "" && ol.Game != "ttt" && ol.Game != "tfc" {
+		return fmt.Errorf("unknown game %q", ol.Game)
+	}
+	if ol.Scheduling.Policy == ExclusivePolicy {
+		return fmt.Errorf("open load does not support the exclusive scheduling policy")
+	}
+	return ol.Scheduling.Validate()
+}
+
+// schedule draws the arrival times of all transactions, as offsets from the
+// start of the load. The arrival times solve Λ(t) = n for the n-th arrival,
+// where Λ integrates the arrival rate. For Poisson arrivals, the steps of n
+// are exponentially distributed.
+func (ol OpenLoad) schedule(rnd *rand.Rand) []time.Duration {
+	nextGap := func() float64 {
+		if ol.Arrivals == "poisson" {
+			return rnd.ExpFloat64()
+		}
+		return 1
+	}
+
+	schedule := []time.Duration{}
+	gap := nextGap()
+	start := time.Duration(0)
+	prevRate := 0.0
+	for _, st := range ol.Stages {
+		d := st.Duration.Seconds()
+		r0 := st.Rate
+		if st.Ramp {
+			r0 = prevRate
+		}
+		slope := (st.Rate - r0) / d
+
+		// at is the integral of the rate from the start of the stage to the
+		// last arrival in it
+		total := r0*d + slope*d*d/2
+		at := 0.0
+		for at+gap <= total {
+			at += gap
+			var s float64
+			if slope == 0 {
+				s = at / r0
+			} else {
+				s = (math.Sqrt(math.Max(0, r0*r0+2*slope*at)) - r0) / slope
+			}
+			schedule = append(schedule, start+time.Duration(s*float64(time.Second)))
+			gap = nextGap()
+		}
+
+		gap -= total - at
+		start += st.Duration
+		prevRate = st.Rate
+	}
+	return schedule
+}
+
+// openLoopGame is a game whose script steps are issued by the open-loop
+// load. It is played by a single worker.
+type openLoopGame struct {
+	cfg     *RunConfig
+	name    string
+	lease   *orgLease
+	players []*TFCClient
+	script  []scriptStep
+	ccName  string
+	next    int
+}
+
+func (g *openLoopGame) done() bool {
+	return g.next >= len(g.script)
+}
+
+// close ends the game, releases its orgs, and settles its artifacts. err is
+// the failure the game ended with, if any.
+func (g *openLoopGame) close(err error) {
+	closePlayers(g.players)
+	g.lease.release()
+	g.cfg.finishGameArtifacts(g.name, err)
+}
+
+// issue plays the next script step of the game. The step is measured as
+// usual, and additionally from the time it was scheduled at, which includes
+// the time it waited for a free game.
+func (g *openLoopGame) issue(ctx context.Context, scheduled time.Time, metrics *PlayerMetrics) error {
+	step := g.script[g.next]
+	g.next++
+
+	trxArgs, err := proto.Marshal(step.message)
+	if err == nil {
+		_, err = runScriptStep(ctx, g.cfg, 0, step, g.ccName, trxArgs)
+	}
+	rt := time.Since(scheduled).Seconds()
+
+	metrics.ObserveScheduled(g.ccName, err != nil, rt)
+	metrics.Record(RunRecord{Time: scheduled, Game: step.player.GameName, Op: ScheduledOp,
+		Org: step.player.OrgID, CC: g.ccName}, rt, err)
+
+	if err != nil {
+		return &GameError{Phase: ScriptPhase, Game: step.player.GameName,
+			Org: step.player.OrgID, Step: g.next - 1, Cause: err}
+	}
+	return nil
+}
+
+// openLoop issues the transactions of an OpenLoad.
+type openLoop struct {
+	cfg     *RunConfig
+	load    OpenLoad
+	runName string
+	metrics *PlayerMetrics
+	ccReq   resmgmt.InstantiateCCRequest
+	// nOfPlayers is the number of orgs each game is played by.
+	nOfPlayers int
+	build      func(players []*TFCClient) ([]scriptStep, error)
+	scheduler  *orgScheduler
+}
+
+// startGame bootstraps a new game on leased orgs, and builds its script.
+func (ol *openLoop) startGame(ctx context.Context, gameName string) (*openLoopGame, error) {
+	lease, err := ol.scheduler.lease(ctx)
+	if err != nil {
+		return nil, newGameError(BootstrapPhase, gameName, "", err)
+	}
+
+	chanOrgs := lease.orgs[:ol.nOfPlayers]
+	players, err := bootstrapAndMeasureChannel(ctx, ol.cfg, gameName, chanOrgs, ol.ccReq, ol.metrics)
+	lease.bootstrapped()
+	if err != nil {
+		lease.release()
+		err = newGameError(BootstrapPhase, gameName, strings.Join(chanOrgs, ","), err)
+		ol.cfg.finishGameArtifacts(gameName, err)
+		return nil, err
+	}
+
+	game := &openLoopGame{cfg: ol.cfg, name: gameName, lease: lease, players: players, ccName: ol.ccReq.Name}
+	game.script, err = ol.build(players)
+	if err != nil {
+		err = newGameError(ScriptPhase, gameName, strings.Join(chanOrgs, ","), err)
+		game.close(err)
+		return nil, err
+	}
+	return game, nil
+}
+
+// newOpenLoop prepares the games of the load.
+func newOpenLoop(cfg *RunConfig, runName string, metrics *PlayerMetrics, load OpenLoad) (*openLoop, error) {
+	ol := &openLoop{cfg: cfg, load: load, runName: runName, metrics: metrics,
+		scheduler: newOrgScheduler(load.Scheduling, cfg.Network.OrgSets, cfg.gameRand(runName+"orgs"), metrics)}
+
+	if load.Script != "" {
+		def, err := loadGameScript(load.Script)
+		if err != nil {
+			return nil, err
+		}
+		ol.ccReq = resmgmt.InstantiateCCRequest{Name: def.ccName(), Path: def.ccPath(), Version: "1.0"}
+		ol.nOfPlayers = len(def.Players)
+		ol.build = func(players []*TFCClient) ([]scriptStep, error) {
+			script, _, err := def.build(players)
+			return script, err
+		}
+		return ol, nil
+	}
+
+	if load.Game == "ttt" {
+		ol.ccReq = resmgmt.InstantiateCCRequest{Name: "ttt", Path: tttCCPath, Version: "1.0"}
+		ol.nOfPlayers = 2
+		ol.build = func(players []*TFCClient) ([]scriptStep, error) {
+			return scriptTTT1(players[0], players[1]), nil
+		}
+		return ol, nil
+	}
+
+	ol.ccReq = resmgmt.InstantiateCCRequest{Name: "tfc", Path: tfcCCPath, Version: "1.0"}
+	ol.nOfPlayers = 3
+	ol.build = func(players []*TFCClient) ([]scriptStep, error) {
+		script, _ := scriptTFC1(players[0], players[1], players[2])
+		return script, nil
+	}
+	return ol, nil
+}
+
+// work plays the arrivals on the games of a slot, one at a time. The first
+// game is bootstrapped before ready is signalled. A worker gives up once it
+// can not bootstrap a game. The games are not bounded by the game timeout,
+// they last as long as the load needs them.
+func (ol *openLoop) work(ctx context.Context, slot int, arrivals <-chan time.Time, ready *sync.WaitGroup) GameErrors {
+	failures := GameErrors{}
+	nOfGames := 0
+	newGame := func() (*openLoopGame, error) {
+		nOfGames++
+		return ol.startGame(ctx, fmt.Sprintf("%s%d-%d", ol.runName, slot+1, nOfGames))
+	}
+
+	game, err := newGame()
+	ready.Done()
+	if err != nil {
+		return append(failures, err)
+	}
+
+	for scheduled := range arrivals {
+		if ctx.Err() != nil {
+			break
+		}
+
+		err := game.issue(ctx, scheduled, ol.metrics)
+		if err != nil {
+			log.Printf("Open loop step failed, starting a new game: %s", err)
+			failures = append(failures, err)
+		}
+
+		if err != nil || game.done() {
+			game.close(err)
+			game, err = newGame()
+			if err != nil {
+				return append(failures, err)
+			}
+		}
+	}
+	game.close(nil)
+	return failures
+}
+
+// runOpenLoop bootstraps the games of the load, and then issues the scheduled
+// transactions to whichever game is free. Transactions are never delayed by
+// the earlier ones, so when all games are busy they queue up, and the time
+// they wait is measured. Once all workers gave up, the remaining transactions
+// are not issued.
+func runOpenLoop(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics, load OpenLoad) error {
+	if err := load.Validate(); err != nil {
+		return err
+	}
+
+	ol, err := newOpenLoop(cfg, runName, metrics, load)
+	if err != nil {
+		return err
+	}
+
+	schedule := load.schedule(cfg.gameRand(runName))
+	log.Printf(" ############# \n\t Starting open loop run *%s* with %v transactions on %v games. \n ##############",
+		runName, len(schedule), load.Games)
+
+	// the queue holds all arrivals, so issuing them never blocks
+	arrivals := make(chan time.Time, len(schedule))
+	results := make(chan GameErrors, load.Games)
+	ready := &sync.WaitGroup{}
+	ready.Add(load.Games)
+	workers := &sync.WaitGroup{}
+	workers.Add(load.Games)
+	for i := 0; i < load.Games; i++ {
+		go func(slot int) {
+			defer workers.Done()
+			results <- ol.work(ctx, slot, arrivals, ready)
+		}(i)
+	}
+	// done is closed once the last worker returned, and no game is left to
+	// play the arrivals
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	ready.Wait()
+
+	start := time.Now()
+	issued := 0
+	for _, offset := range schedule {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		case <-time.After(time.Until(start.Add(offset))):
+			arrivals <- start.Add(offset)
+			issued++
+			continue
+		}
+		break
+	}
+	close(arrivals)
+
+	failures := GameErrors{}
+	for i := 0; i < load.Games; i++ {
+		failures = append(failures, <-results...)
+	}
+
+	log.Printf(" ############# \n\t Finished open loop run *%s* . \n ##############", runName)
+
+	if unserved := len(arrivals) + len(schedule) - issued; unserved > 0 {
+		failures = append(failures, fmt.Errorf("%d transactions were not issued, no game was left to play them", unserved))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("open loop run interrupted after %d of %d transactions: %s", issued, len(schedule), ctx.Err())
+	}
+	return failures.errOrNil()
+}
@@ -0,0 +1,133 @@
+package tfc
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenLoadSchedule(t *testing.T) {
+	constant := OpenLoad{Arrivals: "constant", Stages: []LoadStage{
+		{Duration: time.Second, Rate: 4},
+		{Duration: time.Second, Rate: 2},
+	}}
+	require.Equal(t, []time.Duration{
+		250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, time.Second,
+		1500 * time.Millisecond, 2 * time.Second,
+	}, constant.schedule(rand.New(rand.NewSource(1))))
+
+	// The rate ramps up as 5t, so the n-th arrival is at sqrt(2n/5)
+	ramp := OpenLoad{Arrivals: "constant", Stages: []LoadStage{{Duration: 2 * time.Second, Rate: 10, Ramp: true}}}
+	schedule := ramp.schedule(rand.New(rand.NewSource(1)))
+	require.Len(t, schedule, 10)
+	for i, at := range schedule {
+		expected := math.Sqrt(2 * float64(i+1) / 5)
+		require.InDelta(t, expected, at.Seconds(), 1e-6, "wrong time of arrival %d", i)
+	}
+
+	poisson := OpenLoad{Arrivals: "poisson", Stages: []LoadStage{
+		{Duration: 100 * time.Second, Rate: 50},
+		{Duration: 100 * time.Second, Rate: 0},
+	}}
+	schedule = poisson.schedule(rand.New(rand.NewSource(1)))
+	require.InDelta(t, 5000, len(schedule), 300)
+	for i := 1; i < len(schedule); i++ {
+		require.True(t, schedule[i-1] <= schedule[i], "expected the arrivals in order")
+	}
+	require.True(t, schedule[len(schedule)-1] <= 100*time.Second, "expected no arrivals at rate 0")
+
+	require.Equal(t, schedule, poisson.schedule(rand.New(rand.NewSource(1))),
+		"expected the same arrivals from the same seed")
+}
+
+func TestOpenLoadRejectsInvalid(t *testing.T) {
+	valid := DefaultOpenLoad()
+	require.NoError(t, valid.Validate())
+
+	loads := map[string]func(ol *OpenLoad){
+		"unknown arrivals": func(ol *OpenLoad) { ol.Arrivals = "bursty" },
+		"no stages":        func(ol *OpenLoad) { ol.Stages = nil },
+		"empty stage":      func(ol *OpenLoad) { ol.Stages[0].Duration = 0 },
+		"negative rate":    func(ol *OpenLoad) { ol.Stages[1].Rate = -1 },
+		"no games":         func(ol *OpenLoad) { ol.Games = 0 },
+		"unknown game":     func(ol *OpenLoad) { ol.Game = "chess" },
+		"exclusive":        func(ol *OpenLoad) { ol.Scheduling.Policy = ExclusivePolicy },
+	}
+	for name, invalidate := range loads {
+		ol := DefaultOpenLoad()
+		invalidate(&ol)
+		require.Error(t, ol.Validate(), "expected %s to be rejected", name)
+	}
+}
+
+func TestOpenLoopSim(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	dir, err := ioutil.TempDir("", "openloop")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "run.jsonl")
+	rl, err := NewRunLog(logPath)
+	require.NoError(t, err, "could not create run log")
+	metrics := newTestMetrics(t)
+	metrics.RunLog = rl
+
+	// Every 7 moves complete a game, so 2 of the games are replaced
+	load := OpenLoad{Arrivals: "constant", Stages: []LoadStage{{Duration: time.Second, Rate: 20}},
+		Games: 2, Game: "ttt"}
+	require.NoError(t, runOpenLoop(context.Background(), cfg, "simopen", metrics, load))
+	require.NoError(t, rl.Close())
+
+	records, err := ReadRunLog(logPath)
+	require.NoError(t, err, "could not read run log")
+
+	ops := map[string]int{}
+	for _, rec := range records {
+		ops[rec.Op]++
+		require.True(t, rec.Success, "expected all operations to succeed, got %v", rec)
+		if rec.Op == ScheduledOp {
+			require.Equal(t, "ttt", rec.CC)
+		}
+	}
+	require.Equal(t, map[string]int{BootstrapOp: 4, InvokeOp: 20, ScheduledOp: 20}, ops)
+}
+
+func TestOpenLoopInterrupted(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	load := OpenLoad{Arrivals: "poisson", Stages: []LoadStage{{Duration: time.Minute, Rate: 10}},
+		Games: 1, Game: "ttt"}
+	st := time.Now()
+	err := runOpenLoop(ctx, cfg, "simopencancel", newTestMetrics(t), load)
+	require.Error(t, err, "expected the run to be interrupted")
+	require.True(t, time.Since(st) < 5*time.Second, "expected the run to stop once interrupted")
+}
+
+func TestOpenLoopWorkersGaveUp(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	// The second game of the only worker can not create its channel, so the
+	// worker gives up after the 7 moves of the first game
+	players, err := cfg.Ledger.Connect(context.Background(), cfg, "taken", []string{Player1, Player2})
+	require.NoError(t, err)
+	require.NoError(t, cfg.Ledger.CreateChannel(context.Background(), players, "simgiveup1-2"))
+
+	load := OpenLoad{Arrivals: "constant", Stages: []LoadStage{{Duration: time.Minute, Rate: 20}},
+		Games: 1, Game: "ttt"}
+	st := time.Now()
+	err = runOpenLoop(context.Background(), cfg, "simgiveup", newTestMetrics(t), load)
+	require.Error(t, err, "expected the failed bootstrap to be reported")
+	require.Contains(t, err.Error(), "transactions were not issued")
+	require.True(t, time.Since(st) < 5*time.Second, "expected the run to stop once all workers gave up")
+}
@@ -0,0 +1,119 @@
+package tfc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// Labels of the transaction phases.
+const (
+	EndorsementPhase = "Endorsement"
+	CommitPhase      = "Commit"
+	TotalPhase       = "Total"
+	// ScheduledPhase is the time from scheduling an open-loop script step
+	// until it completed, including the time it waited for a free game.
+	ScheduledPhase = "Scheduled"
+)
+
+// TrxPhases holds the durations of the phases of a transaction. Phases which
+// were not reached, because the transaction failed, are zero.
+type TrxPhases struct {
+	// Endorsement is the time from sending the proposal until the
+	// endorsements were collected and validated.
+	Endorsement time.Duration
+	// Commit is the time from submitting the transaction to the orderer
+	// until the commit event was received.
+	Commit time.Duration
+	Total  time.Duration
+}
+
+// phaseTimer records when a transaction reaches each phase, and the ID of the
+// transaction once it was proposed. The handler chain runs asynchronously to
+// the client call, so the marks are locked.
+type phaseTimer struct {
+	lock      sync.Mutex
+	start     time.Time
+	endorsed  time.Time
+	committed time.Time
+	trxID     fab.TransactionID
+}
+
+// phaseMark is a handler recording the time it is reached, before delegating
+// to the next handler in the chain.
+type phaseMark struct {
+	timer *phaseTimer
+	at    *time.Time
+	next  invoke.Handler
+}
+
+func (pm *phaseMark) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	pm.timer.lock.Lock()
+	if pm.at == &pm.timer.start {
+		// a retry starts over
+		pm.timer.endorsed, pm.timer.committed = time.Time{}, time.Time{}
+	}
+	*pm.at = time.Now()
+	pm.timer.lock.Unlock()
+
+	if pm.next != nil {
+		pm.next.Handle(requestContext, clientContext)
+	}
+
+	// The SDK drops the response of failed transactions, keep their ID
+	if pm.at == &pm.timer.start && requestContext != nil {
+		pm.timer.lock.Lock()
+		pm.timer.trxID = requestContext.Response.TransactionID
+		pm.timer.lock.Unlock()
+	}
+}
+
+// newTimedExecuteHandler returns the SDK execute handler chain, with marks
+// around the endorsement and commit handlers.
+func newTimedExecuteHandler(timer *phaseTimer) invoke.Handler {
+	committed := &phaseMark{timer: timer, at: &timer.committed}
+	endorsed := &phaseMark{timer: timer, at: &timer.endorsed, next: invoke.NewCommitHandler(committed)}
+
+	return &phaseMark{timer: timer, at: &timer.start,
+		next: invoke.NewSelectAndEndorseHandler(
+			invoke.NewEndorsementValidationHandler(
+				invoke.NewSignatureValidationHandler(endorsed),
+			),
+		),
+	}
+}
+
+// phases returns the durations of the phases the transaction went through.
+// With retries, only the last attempt is measured.
+func (pt *phaseTimer) phases() TrxPhases {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	phases := TrxPhases{}
+	if pt.start.IsZero() {
+		return phases
+	}
+
+	end := pt.committed
+	if !pt.endorsed.IsZero() {
+		phases.Endorsement = pt.endorsed.Sub(pt.start)
+		if !pt.committed.IsZero() {
+			phases.Commit = pt.committed.Sub(pt.endorsed)
+		}
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	phases.Total = end.Sub(pt.start)
+	return phases
+}
+
+// transactionID returns the ID of the last attempt of the transaction, or an
+// empty ID if it was not proposed.
+func (pt *phaseTimer) transactionID() fab.TransactionID {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+	return pt.trxID
+}
@@ -0,0 +1,77 @@
+package tfc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/stretchr/testify/require"
+)
+
+// sleepHandler stands in for an SDK handler taking d to complete, and fails
+// when next is nil.
+type sleepHandler struct {
+	d    time.Duration
+	next invoke.Handler
+}
+
+func (sh *sleepHandler) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	time.Sleep(sh.d)
+	if sh.next != nil {
+		sh.next.Handle(requestContext, clientContext)
+	}
+}
+
+// failedProposal stands in for an SDK handler proposing a transaction which
+// is not endorsed.
+type failedProposal struct{}
+
+func (failedProposal) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	requestContext.Response.TransactionID = "abc"
+}
+
+func timedChain(timer *phaseTimer, commits bool) invoke.Handler {
+	committed := &phaseMark{timer: timer, at: &timer.committed}
+	commit := &sleepHandler{d: 20 * time.Millisecond}
+	if commits {
+		commit.next = committed
+	}
+	endorsed := &phaseMark{timer: timer, at: &timer.endorsed, next: commit}
+	return &phaseMark{timer: timer, at: &timer.start,
+		next: &sleepHandler{d: 10 * time.Millisecond, next: endorsed}}
+}
+
+func TestPhaseTimer(t *testing.T) {
+	timer := &phaseTimer{}
+	timedChain(timer, true).Handle(nil, nil)
+
+	phases := timer.phases()
+	require.True(t, phases.Endorsement >= 10*time.Millisecond, "endorsement took %v", phases.Endorsement)
+	require.True(t, phases.Commit >= 20*time.Millisecond, "commit took %v", phases.Commit)
+	require.Equal(t, phases.Endorsement+phases.Commit, phases.Total)
+}
+
+func TestPhaseTimerFailedCommit(t *testing.T) {
+	timer := &phaseTimer{}
+	chain := timedChain(timer, false)
+
+	// a retry should not reuse the marks of the first attempt
+	chain.Handle(nil, nil)
+	chain.Handle(nil, nil)
+
+	phases := timer.phases()
+	require.True(t, phases.Endorsement >= 10*time.Millisecond, "endorsement took %v", phases.Endorsement)
+	require.True(t, phases.Endorsement < 30*time.Millisecond, "endorsement took %v", phases.Endorsement)
+	require.Zero(t, phases.Commit)
+	require.True(t, phases.Total >= 30*time.Millisecond, "total took %v", phases.Total)
+
+	require.Zero(t, (&phaseTimer{}).phases())
+}
+
+func TestPhaseTimerKeepsFailedTrxID(t *testing.T) {
+	timer := &phaseTimer{}
+	chain := &phaseMark{timer: timer, at: &timer.start, next: failedProposal{}}
+
+	chain.Handle(&invoke.RequestContext{}, nil)
+	require.Equal(t, "abc", string(timer.transactionID()))
+}
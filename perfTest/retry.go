@@ -0,0 +1,184 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+)
+
+// ErrorClass is the kind of a transaction failure. It decides whether the
+// failed script step is retried.
+type ErrorClass string
+
+// Classes of transaction failures.
+const (
+	// ConflictError is an MVCC or phantom read conflict with a concurrent
+	// transaction.
+	ConflictError ErrorClass = "conflict"
+	// EndorsementError covers mismatching, missing or invalid endorsements.
+	EndorsementError ErrorClass = "endorsement"
+	// UnavailableError covers peers or orderers which can not be reached, or
+	// chaincode which is not running yet.
+	UnavailableError ErrorClass = "unavailable"
+	TimeoutError     ErrorClass = "timeout"
+	// RejectedError is a transaction rejected by the chaincode, such as an
+	// illegal move.
+	RejectedError ErrorClass = "rejected"
+	UnknownError  ErrorClass = "unknown"
+)
+
+var errorClasses = []ErrorClass{ConflictError, EndorsementError, UnavailableError,
+	TimeoutError, RejectedError, UnknownError}
+
+// classifyError finds the class of a transaction failure from the status
+// reported by the SDK.
+func classifyError(err error) ErrorClass {
+	if err == context.DeadlineExceeded {
+		return TimeoutError
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return UnknownError
+	}
+
+	switch s.Group {
+	case status.EventServerStatus:
+		switch status.ToTransactionValidationCode(s.Code) {
+		case pb.TxValidationCode_MVCC_READ_CONFLICT, pb.TxValidationCode_PHANTOM_READ_CONFLICT:
+			return ConflictError
+		case pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:
+			return EndorsementError
+		}
+	case status.EndorserClientStatus, status.OrdererClientStatus, status.ClientStatus:
+		switch status.ToSDKStatusCode(s.Code) {
+		case status.EndorsementMismatch, status.MissingEndorsement, status.SignatureVerificationFailed:
+			return EndorsementError
+		case status.ConnectionFailed, status.NoPeersFound,
+			status.PrematureChaincodeExecution, status.ChaincodeAlreadyLaunching:
+			return UnavailableError
+		case status.Timeout:
+			return TimeoutError
+		}
+	case status.EndorserServerStatus, status.OrdererServerStatus:
+		if status.ToFabricCommonStatusCode(s.Code) == common.Status_SERVICE_UNAVAILABLE {
+			return UnavailableError
+		}
+	case status.GRPCTransportStatus:
+		return UnavailableError
+	case status.ChaincodeStatus:
+		return RejectedError
+	}
+	return UnknownError
+}
+
+// RetryPolicy decides how failed script steps are retried. Retries wait an
+// exponentially growing backoff, starting from InitialBackoff and capped at
+// MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts of a step, including the first.
+	// Zero retries until the step times out.
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff caps the backoff. Zero means no cap.
+	MaxBackoff    time.Duration `yaml:"maxBackoff"`
+	BackoffFactor float64       `yaml:"backoffFactor"`
+	// Retryable are the classes of failures worth retrying. Any other
+	// failure fails the step on the first attempt.
+	Retryable []ErrorClass `yaml:"retryable"`
+}
+
+// DefaultRetryPolicy retries transient failures five times, but never
+// transactions rejected by the chaincode.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		BackoffFactor:  2,
+		Retryable:      []ErrorClass{ConflictError, EndorsementError, UnavailableError, TimeoutError},
+	}
+}
+
+// UnmarshalYAML fills the fields missing from the YAML with the
+// DefaultRetryPolicy.
+func (rp *RetryPolicy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain RetryPolicy
+	p := plain(DefaultRetryPolicy())
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	*rp = RetryPolicy(p)
+	return nil
+}
+
+// Validate checks that the policy can be applied.
+func (rp RetryPolicy) Validate() error {
+	if rp.MaxAttempts < 0 {
+		return fmt.Errorf("retry policy can not have negative attempts, got %d", rp.MaxAttempts)
+	}
+	if rp.InitialBackoff < 0 || rp.MaxBackoff < 0 {
+		return fmt.Errorf("retry policy can not have negative backoffs")
+	}
+	if rp.BackoffFactor < 1 {
+		return fmt.Errorf("retry policy needs a backoff factor of at least 1, got %v", rp.BackoffFactor)
+	}
+	for _, class := range rp.Retryable {
+		if !rp.known(class) {
+			return fmt.Errorf("unknown error class %q, expected one of %v", class, errorClasses)
+		}
+	}
+	return nil
+}
+
+func (rp RetryPolicy) known(class ErrorClass) bool {
+	for _, c := range errorClasses {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// retries reports whether the step should be attempted again, after the
+// attempts so far failed with an error of the class.
+func (rp RetryPolicy) retries(attempts int, class ErrorClass) bool {
+	if rp.MaxAttempts > 0 && attempts >= rp.MaxAttempts {
+		return false
+	}
+	for _, c := range rp.Retryable {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff is the time to wait before the retry following the given number of
+// failed attempts.
+func (rp RetryPolicy) backoff(attempts int) time.Duration {
+	backoff := float64(rp.InitialBackoff) * math.Pow(rp.BackoffFactor, float64(attempts-1))
+	if rp.MaxBackoff > 0 && backoff > float64(rp.MaxBackoff) {
+		return rp.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// RetryError reports a script step which failed all the attempts allowed by
+// its retry policy.
+type RetryError struct {
+	Attempts int
+	// Class is the class of the last failure.
+	Class ErrorClass
+	Last  error
+}
+
+func (re *RetryError) Error() string {
+	return fmt.Sprintf("gave up after %d attempt(s), last failure was a %s error: %s",
+		re.Attempts, re.Class, re.Last)
+}
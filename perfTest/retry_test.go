@@ -0,0 +1,87 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/common"
+	pb "github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/protos/peer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestClassifyError(t *testing.T) {
+	errs := map[ErrorClass][]error{
+		ConflictError: {
+			status.New(status.EventServerStatus, int32(pb.TxValidationCode_MVCC_READ_CONFLICT), "", nil),
+			errors.WithMessage(status.New(status.EventServerStatus, int32(pb.TxValidationCode_PHANTOM_READ_CONFLICT), "", nil), "Failed to invoke cc"),
+		},
+		EndorsementError: {
+			status.New(status.EndorserClientStatus, status.EndorsementMismatch.ToInt32(), "", nil),
+			status.New(status.EventServerStatus, int32(pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE), "", nil),
+		},
+		UnavailableError: {
+			status.New(status.EndorserClientStatus, status.ConnectionFailed.ToInt32(), "", nil),
+			status.New(status.EndorserServerStatus, int32(common.Status_SERVICE_UNAVAILABLE), "", nil),
+		},
+		TimeoutError: {
+			status.New(status.ClientStatus, status.Timeout.ToInt32(), "", nil),
+			context.DeadlineExceeded,
+		},
+		RejectedError: {
+			status.New(status.ChaincodeStatus, 500, "illegal move", nil),
+		},
+		UnknownError: {
+			fmt.Errorf("org has not joined any channel"),
+			status.New(status.EventServerStatus, int32(pb.TxValidationCode_BAD_PAYLOAD), "", nil),
+		},
+	}
+
+	for class, classErrs := range errs {
+		for _, err := range classErrs {
+			require.Equal(t, class, classifyError(err), "wrong class for %s", err)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	rp := RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second,
+		BackoffFactor: 2, Retryable: []ErrorClass{ConflictError}}
+	require.NoError(t, rp.Validate())
+
+	require.Equal(t, time.Second, rp.backoff(1))
+	require.Equal(t, 2*time.Second, rp.backoff(2))
+	require.Equal(t, 3*time.Second, rp.backoff(3), "expected the backoff to be capped")
+
+	require.True(t, rp.retries(3, ConflictError))
+	require.False(t, rp.retries(4, ConflictError), "expected no attempts after the last")
+	require.False(t, rp.retries(1, RejectedError), "expected rejections not to be retried")
+
+	rp.MaxAttempts = 0
+	require.True(t, rp.retries(100, ConflictError), "expected unlimited attempts")
+}
+
+func TestRetryPolicyYAML(t *testing.T) {
+	rp := RetryPolicy{}
+	err := yaml.UnmarshalStrict([]byte("{maxAttempts: 2, retryable: [rejected]}"), &rp)
+	require.NoError(t, err)
+
+	expected := DefaultRetryPolicy()
+	expected.MaxAttempts = 2
+	expected.Retryable = []ErrorClass{RejectedError}
+	require.Equal(t, expected, rp, "expected the missing fields to be defaults")
+
+	invalid := []RetryPolicy{
+		{MaxAttempts: -1, BackoffFactor: 1},
+		{InitialBackoff: -time.Second, BackoffFactor: 1},
+		{BackoffFactor: 0.5},
+		{BackoffFactor: 1, Retryable: []ErrorClass{"gremlins"}},
+	}
+	for _, rp := range invalid {
+		require.Error(t, rp.Validate(), "expected %v to be rejected", rp)
+	}
+}
@@ -0,0 +1,80 @@
+package tfc
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// RunConfig configures the games of an experiment: the ledger and network
+// they are played on, how their steps are timed, retried and endorsed, and
+// what is left of them once they are over. Every experiment is given its
+// config, so experiments with different configs can run side by side.
+type RunConfig struct {
+	// Ledger is the backend the games are played on.
+	Ledger Ledger
+	// Network is the network the games are bootstrapped on.
+	Network Network
+	// GameTimeout bounds a whole game, from bootstrapping its channel to the
+	// creation of its last alliance. StepTimeout bounds a single script step,
+	// including its retries. A zero timeout means no deadline.
+	GameTimeout time.Duration
+	StepTimeout time.Duration
+	// Retry is the retry policy of the script steps which don't define
+	// their own.
+	Retry RetryPolicy
+	// ThinkTimes are the think times of the players, unless the game script
+	// defines its own.
+	ThinkTimes ThinkTimes
+	// Endorsement picks the peers endorsing the transactions of the games.
+	Endorsement Endorsement
+	// OpenLoad is the load of the openloop experiment.
+	OpenLoad OpenLoad
+	// TemplateDir holds the templates overriding the bundled ones, under the
+	// same name, such as pConfig.yaml_template. The bundled templates are
+	// used if it is empty.
+	TemplateDir string
+	// Cleanup decides what is removed from the network once a game is over.
+	Cleanup Cleanup
+	// Seed is the seed of the run. The random sources of all games are
+	// derived from it and the game names, so runs with the same seed make the
+	// same random choices, whatever the order the games are scheduled in.
+	Seed int64
+
+	// artifacts and leftovers are shared by the copies of the config.
+	artifacts *artifactManager
+	leftovers *leftoverContainers
+}
+
+// DefaultRunConfig plays the games on the Fabric network of the five
+// players, with the default timeouts, retries, think times and load, and a
+// random seed.
+func DefaultRunConfig() *RunConfig {
+	return &RunConfig{
+		Ledger:      fabricLedger{},
+		Network:     DefaultNetwork(),
+		GameTimeout: 30 * time.Minute,
+		StepTimeout: 2 * time.Minute,
+		Retry:       DefaultRetryPolicy(),
+		ThinkTimes:  DefaultThinkTimes(),
+		OpenLoad:    DefaultOpenLoad(),
+		Cleanup:     DefaultCleanup(),
+		Seed:        time.Now().UnixNano(),
+		artifacts:   newArtifactManager(DefaultArtifactRetention(), "default"),
+		leftovers:   &leftoverContainers{},
+	}
+}
+
+// UseSimLedger makes the games run on an in-process simulated ledger, with
+// the game chaincodes installed.
+func (cfg *RunConfig) UseSimLedger() {
+	cfg.Ledger = NewSimLedger("ttt", "tfc")
+}
+
+// gameRand returns the random source of the game. Sources are not safe for
+// concurrent use, each game needs its own.
+func (cfg *RunConfig) gameRand(gameName string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(gameName))
+	return rand.New(rand.NewSource(cfg.Seed ^ int64(h.Sum64())))
+}
@@ -0,0 +1,213 @@
+package tfc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the run log.
+const (
+	InvokeOp    = "invoke"
+	BootstrapOp = "bootstrap"
+	AllianceOp  = "alliance"
+	// ScheduledOp measures an open-loop script step from the time it was
+	// scheduled at, instead of the time it was issued at.
+	ScheduledOp = "scheduled"
+	// CleanupOp measures the removal of the alliance containers of a game.
+	CleanupOp = "cleanup"
+)
+
+// RunRecord is the outcome of a single measured operation.
+type RunRecord struct {
+	Time  time.Time `json:"time"`
+	Game  string    `json:"game"`
+	Op    string    `json:"op"`
+	Org   string    `json:"org"`
+	CC    string    `json:"cc"`
+	TrxID string    `json:"trxId,omitempty"`
+	// Latency is in seconds.
+	Latency float64 `json:"latency"`
+	Success bool    `json:"success"`
+	Error   string  `json:"error,omitempty"`
+	// Stage is the load stage the operation ran in, if any.
+	Stage string `json:"stage,omitempty"`
+}
+
+var runLogHeader = []string{"time", "game", "op", "org", "cc", "trxId", "latency", "success", "error", "stage"}
+
+func (rec RunRecord) csvRow() []string {
+	return []string{
+		rec.Time.Format(time.RFC3339Nano),
+		rec.Game,
+		rec.Op,
+		rec.Org,
+		rec.CC,
+		rec.TrxID,
+		strconv.FormatFloat(rec.Latency, 'f', -1, 64),
+		strconv.FormatBool(rec.Success),
+		rec.Error,
+		rec.Stage,
+	}
+}
+
+// RunLog appends run records to a CSV or JSON lines file. It is safe for
+// concurrent use.
+type RunLog struct {
+	lock   sync.Mutex
+	out    io.Writer
+	csvOut *csv.Writer
+	json   *json.Encoder
+}
+
+// NewRunLog creates the run log file at logPath. The format is chosen from
+// the extension: .csv, or .jsonl for JSON lines.
+func NewRunLog(logPath string) (*RunLog, error) {
+	format := filepath.Ext(logPath)
+	if format != ".csv" && format != ".jsonl" {
+		return nil, fmt.Errorf("unknown run log format %q, expected .csv or .jsonl", format)
+	}
+
+	f, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not create run log: %s", err)
+	}
+
+	rl, err := newRunLog(f, format)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return rl, nil
+}
+
+func newRunLog(out io.Writer, format string) (*RunLog, error) {
+	rl := &RunLog{out: out}
+	if format == ".jsonl" {
+		rl.json = json.NewEncoder(out)
+		return rl, nil
+	}
+
+	rl.csvOut = csv.NewWriter(out)
+	rl.csvOut.Write(runLogHeader)
+	rl.csvOut.Flush()
+	if err := rl.csvOut.Error(); err != nil {
+		return nil, fmt.Errorf("could not write run log header: %s", err)
+	}
+	return rl, nil
+}
+
+// Record appends the record to the log. Records are written through, so the
+// log is complete even if the run is aborted.
+func (rl *RunLog) Record(rec RunRecord) error {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if rl.json != nil {
+		return rl.json.Encode(rec)
+	}
+
+	rl.csvOut.Write(rec.csvRow())
+	rl.csvOut.Flush()
+	return rl.csvOut.Error()
+}
+
+// Close closes the underlying file.
+func (rl *RunLog) Close() error {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if c, ok := rl.out.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReadRunLog reads all records of the run log file at logPath.
+func ReadRunLog(logPath string) ([]RunRecord, error) {
+	format := filepath.Ext(logPath)
+	if format != ".csv" && format != ".jsonl" {
+		return nil, fmt.Errorf("unknown run log format %q, expected .csv or .jsonl", format)
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open run log: %s", err)
+	}
+	defer f.Close()
+
+	if format == ".jsonl" {
+		return readRunLogJSON(f)
+	}
+	return readRunLogCSV(f)
+}
+
+func readRunLogJSON(in io.Reader) ([]RunRecord, error) {
+	records := []RunRecord{}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		rec := RunRecord{}
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse run log line %d: %s", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read run log: %s", err)
+	}
+	return records, nil
+}
+
+func readRunLogCSV(in io.Reader) ([]RunRecord, error) {
+	rows, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("could not parse run log: %s", err)
+	}
+	// logs written before the stage column have one column less
+	if len(rows) == 0 || (strings.Join(rows[0], ",") != strings.Join(runLogHeader, ",") &&
+		strings.Join(rows[0], ",") != strings.Join(runLogHeader[:len(runLogHeader)-1], ",")) {
+		return nil, fmt.Errorf("unexpected run log header, expected %v", runLogHeader)
+	}
+
+	records := []RunRecord{}
+	for i, row := range rows[1:] {
+		at, err := time.Parse(time.RFC3339Nano, row[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse time of run log line %d: %s", i+2, err)
+		}
+		latency, err := strconv.ParseFloat(row[6], 64)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse latency of run log line %d: %s", i+2, err)
+		}
+		success, err := strconv.ParseBool(row[7])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse success of run log line %d: %s", i+2, err)
+		}
+
+		rec := RunRecord{
+			Time:    at,
+			Game:    row[1],
+			Op:      row[2],
+			Org:     row[3],
+			CC:      row[4],
+			TrxID:   row[5],
+			Latency: latency,
+			Success: success,
+			Error:   row[8],
+		}
+		if len(row) > 9 {
+			rec.Stage = row[9]
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
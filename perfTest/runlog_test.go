@@ -0,0 +1,129 @@
+package tfc
+
+import (
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLogCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "run.csv")
+	rl, err := NewRunLog(logPath)
+	require.NoError(t, err, "could not create run log")
+
+	at := time.Date(2019, 5, 11, 11, 53, 52, 0, time.UTC)
+	require.NoError(t, rl.Record(RunRecord{Time: at, Game: "ttt1", Op: InvokeOp, Org: Player1,
+		CC: "ttt", TrxID: "abc", Latency: 0.25, Success: true}))
+	require.NoError(t, rl.Record(RunRecord{Time: at, Game: "ttt1", Op: InvokeOp, Org: Player2,
+		CC: "ttt", Latency: 1.5, Error: "failed, badly"}))
+	require.NoError(t, rl.Close())
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err, "expected a valid CSV file")
+
+	require.Equal(t, [][]string{
+		runLogHeader,
+		{"2019-05-11T11:53:52Z", "ttt1", "invoke", "Player1", "ttt", "abc", "0.25", "true", "", ""},
+		{"2019-05-11T11:53:52Z", "ttt1", "invoke", "Player2", "ttt", "", "1.5", "false", "failed, badly", ""},
+	}, rows)
+
+	records, err := ReadRunLog(logPath)
+	require.NoError(t, err, "could not read run log")
+	require.Len(t, records, 2)
+	require.Equal(t, "failed, badly", records[1].Error)
+	require.Equal(t, 1.5, records[1].Latency)
+	require.False(t, records[1].Success)
+
+	_, err = NewRunLog(filepath.Join(dir, "run.txt"))
+	require.Error(t, err, "expected unknown formats to be rejected")
+}
+
+func TestRunLogGame(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	dir, err := ioutil.TempDir("", "runlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "run.jsonl")
+	rl, err := NewRunLog(logPath)
+	require.NoError(t, err, "could not create run log")
+
+	metrics := newTestMetrics(t)
+	metrics.RunLog = rl
+
+	errOut := make(chan (error), 1)
+	lease := leaseOrgs([]string{Player1, Player2}, metrics)
+
+	execTTTGameAsync(context.Background(), cfg, "runlogttt", metrics, errOut, lease)
+	require.NoError(t, <-errOut)
+	require.NoError(t, rl.Close())
+
+	records, err := ReadRunLog(logPath)
+	require.NoError(t, err, "could not read run log")
+
+	require.Len(t, records, 8, "expected the bootstrap and one record per move")
+	require.Equal(t, BootstrapOp, records[0].Op)
+	require.Equal(t, "Player1,Player2", records[0].Org)
+	for i, rec := range records[1:] {
+		require.Equal(t, InvokeOp, rec.Op)
+		require.Equal(t, "runlogttt", rec.Game)
+		require.Equal(t, []string{Player1, Player2}[i%2], rec.Org)
+		require.NotEmpty(t, rec.TrxID)
+		require.True(t, rec.Success)
+	}
+}
+
+func TestRunLogFailedStep(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	dir, err := ioutil.TempDir("", "runlog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "run.jsonl")
+	rl, err := NewRunLog(logPath)
+	require.NoError(t, err, "could not create run log")
+
+	metrics := newTestMetrics(t)
+	metrics.RunLog = rl
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "ttt", Path: tttCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "runlogfailed", []string{Player1, Player2}, ccReq, metrics)
+	require.NoError(t, err, "could not bootstrap channel")
+	defer closePlayers(players)
+
+	move := func(p *TFCClient, mark tttPb.Mark) error {
+		trxArgs, err := proto.Marshal(&tttPb.TrxArgs{Type: tttPb.TrxType_MOVE,
+			MovePayload: &tttPb.MoveTrxPayload{Position: 0, Mark: mark}})
+		require.NoError(t, err)
+		_, err = invokeAndMeasure(context.Background(), p, "ttt", "ttt", trxArgs)
+		return err
+	}
+	require.NoError(t, move(players[0], tttPb.Mark_X))
+	require.Error(t, move(players[1], tttPb.Mark_O), "expected the move on a marked position to be rejected")
+	require.NoError(t, rl.Close())
+
+	records, err := ReadRunLog(logPath)
+	require.NoError(t, err, "could not read run log")
+	require.Len(t, records, 2)
+	require.False(t, records[1].Success)
+	require.NotEmpty(t, records[1].TrxID, "expected the failed transaction to have an ID")
+	require.NotEqual(t, records[0].TrxID, records[1].TrxID)
+}
@@ -0,0 +1,217 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Org scheduling policies.
+const (
+	RoundRobinPolicy  = "round-robin"
+	LeastLoadedPolicy = "least-loaded"
+	RandomPolicy      = "random"
+	ExclusivePolicy   = "exclusive"
+)
+
+// OrgScheduling decides which org set of a pool is leased to each game.
+// Policy is one of:
+//   - round-robin: the org sets in turn
+//   - least-loaded: the org set whose orgs play the fewest games
+//   - random: an org set picked at random
+//   - exclusive: an org set none of whose orgs plays a game of the pool,
+//     waiting for one if there is none
+//
+// An empty policy is round-robin.
+type OrgScheduling struct {
+	Policy string `yaml:"policy"`
+	// MaxBootstraps is the number of games bootstrapping their channels at
+	// once. Zero bootstraps one game at a time.
+	MaxBootstraps int `yaml:"maxBootstraps"`
+}
+
+// Validate checks the policy.
+func (sc OrgScheduling) Validate() error {
+	switch sc.Policy {
+	case "", RoundRobinPolicy, LeastLoadedPolicy, RandomPolicy, ExclusivePolicy:
+	default:
+		return fmt.Errorf("unknown scheduling policy %q", sc.Policy)
+	}
+	if sc.MaxBootstraps < 0 {
+		return fmt.Errorf("scheduling can not have negative bootstraps, got %d", sc.MaxBootstraps)
+	}
+	return nil
+}
+
+// orgScheduler leases the org sets of a pool to games, and keeps track of the
+// number of games each org plays. It is safe for concurrent use.
+type orgScheduler struct {
+	policy  string
+	orgSets [][]string
+	rnd     *rand.Rand
+	metrics *PlayerMetrics
+
+	// bootstraps holds a token for every game bootstrapping its channel
+	bootstraps chan struct{}
+
+	lock sync.Mutex
+	next int
+	// load counts the games each org is currently playing
+	load map[string]int
+	// played counts all the games each org has played, including finished ones
+	played map[string]int
+	// released is closed, and replaced, whenever a lease is released
+	released chan struct{}
+}
+
+func newOrgScheduler(scheduling OrgScheduling, orgSets [][]string, rnd *rand.Rand, metrics *PlayerMetrics) *orgScheduler {
+	maxBootstraps := scheduling.MaxBootstraps
+	if maxBootstraps == 0 {
+		maxBootstraps = 1
+	}
+	policy := scheduling.Policy
+	if policy == "" {
+		policy = RoundRobinPolicy
+	}
+
+	return &orgScheduler{
+		policy:     policy,
+		orgSets:    orgSets,
+		rnd:        rnd,
+		metrics:    metrics,
+		bootstraps: make(chan struct{}, maxBootstraps),
+		load:       make(map[string]int),
+		played:     make(map[string]int),
+		released:   make(chan struct{}),
+	}
+}
+
+// orgLease is an org set leased to a game. The game calls bootstrapped once
+// its channel is up, and release once it is over.
+type orgLease struct {
+	orgs      []string
+	scheduler *orgScheduler
+
+	bootstrapOnce sync.Once
+	releaseOnce   sync.Once
+}
+
+// lease waits for a bootstrap slot and for an org set allowed by the
+// policy, and leases the org set.
+func (s *orgScheduler) lease(ctx context.Context) (*orgLease, error) {
+	select {
+	case s.bootstraps <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	for {
+		s.lock.Lock()
+		orgs, ok := s.pick()
+		if ok {
+			s.acquire(orgs)
+			s.lock.Unlock()
+			return &orgLease{orgs: orgs, scheduler: s}, nil
+		}
+		released := s.released
+		s.lock.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			<-s.bootstraps
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// pick chooses an org set by the policy. It fails if the policy allows none
+// of them right now.
+func (s *orgScheduler) pick() ([]string, bool) {
+	n := len(s.orgSets)
+	switch s.policy {
+	case RandomPolicy:
+		return s.orgSets[s.rnd.Intn(n)], true
+	case LeastLoadedPolicy, ExclusivePolicy:
+		// ties are broken in turn, starting after the last pick
+		best, bestLoad := -1, 0
+		for i := 0; i < n; i++ {
+			idx := (s.next + i) % n
+			load := 0
+			for _, org := range s.orgSets[idx] {
+				load += s.load[org]
+			}
+			if s.policy == ExclusivePolicy && load > 0 {
+				continue
+			}
+			if best < 0 || load < bestLoad {
+				best, bestLoad = idx, load
+			}
+		}
+		if best < 0 {
+			return nil, false
+		}
+		s.next = best + 1
+		return s.orgSets[best], true
+	}
+
+	orgs := s.orgSets[s.next%n]
+	s.next++
+	return orgs, true
+}
+
+func (s *orgScheduler) acquire(orgs []string) {
+	for _, org := range orgs {
+		s.load[org]++
+		s.played[org]++
+		s.metrics.ObserveOrgGames(org, s.load[org])
+	}
+}
+
+func (s *orgScheduler) release(orgs []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, org := range orgs {
+		s.load[org]--
+		s.metrics.ObserveOrgGames(org, s.load[org])
+	}
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+// logLoad logs the number of games played by each org.
+func (s *orgScheduler) logLoad(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	orgs := []string{}
+	for org := range s.played {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+	for _, org := range orgs {
+		log.Printf("Org %s played %d games of %s", org, s.played[org], name)
+	}
+}
+
+// bootstrapped frees the bootstrap slot of the game.
+func (l *orgLease) bootstrapped() {
+	l.bootstrapOnce.Do(func() { <-l.scheduler.bootstraps })
+}
+
+// release returns the org set once the game is over.
+func (l *orgLease) release() {
+	l.bootstrapped()
+	l.releaseOnce.Do(func() { l.scheduler.release(l.orgs) })
+}
+
+// leaseOrgs leases the org set to a single game.
+func leaseOrgs(orgs []string, metrics *PlayerMetrics) *orgLease {
+	s := newOrgScheduler(OrgScheduling{}, [][]string{orgs}, nil, metrics)
+	lease, _ := s.lease(context.Background())
+	return lease
+}
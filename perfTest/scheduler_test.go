@@ -0,0 +1,97 @@
+package tfc
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var schedulerOrgSets = [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}}
+
+// leaseAll leases n org sets, freeing the bootstrap slot of each.
+func leaseAll(t *testing.T, s *orgScheduler, n int) []*orgLease {
+	leases := []*orgLease{}
+	for i := 0; i < n; i++ {
+		lease, err := s.lease(context.Background())
+		require.NoError(t, err, "could not lease org set %d", i)
+		lease.bootstrapped()
+		leases = append(leases, lease)
+	}
+	return leases
+}
+
+func leasedOrgs(leases []*orgLease) [][]string {
+	orgs := [][]string{}
+	for _, l := range leases {
+		orgs = append(orgs, l.orgs)
+	}
+	return orgs
+}
+
+func TestOrgSchedulerPolicies(t *testing.T) {
+	metrics := newTestMetrics(t)
+
+	s := newOrgScheduler(OrgScheduling{}, schedulerOrgSets, nil, metrics)
+	require.Equal(t, [][]string{{"A", "B"}, {"B", "C"}, {"C", "D"}, {"A", "B"}},
+		leasedOrgs(leaseAll(t, s, 4)), "expected round-robin by default")
+
+	s = newOrgScheduler(OrgScheduling{Policy: LeastLoadedPolicy}, schedulerOrgSets, nil, metrics)
+	leases := leaseAll(t, s, 3)
+	require.Equal(t, [][]string{{"A", "B"}, {"C", "D"}, {"A", "B"}}, leasedOrgs(leases))
+	leases[1].release()
+	require.Equal(t, [][]string{{"C", "D"}}, leasedOrgs(leaseAll(t, s, 1)),
+		"expected the org set of the finished game")
+	require.Equal(t, map[string]int{"A": 2, "B": 2, "C": 1, "D": 1}, s.load)
+	require.Equal(t, map[string]int{"A": 2, "B": 2, "C": 2, "D": 2}, s.played)
+
+	random := func() [][]string {
+		s := newOrgScheduler(OrgScheduling{Policy: RandomPolicy}, schedulerOrgSets, rand.New(rand.NewSource(1)), metrics)
+		return leasedOrgs(leaseAll(t, s, 10))
+	}
+	require.Equal(t, random(), random(), "expected the same org sets from the same seed")
+}
+
+func TestOrgSchedulerExclusive(t *testing.T) {
+	s := newOrgScheduler(OrgScheduling{Policy: ExclusivePolicy, MaxBootstraps: 2}, schedulerOrgSets, nil, newTestMetrics(t))
+	leases := leaseAll(t, s, 2)
+	require.Equal(t, [][]string{{"A", "B"}, {"C", "D"}}, leasedOrgs(leases))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := s.lease(ctx)
+	require.Equal(t, context.DeadlineExceeded, err, "expected no org set to be free")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		leases[0].release()
+	}()
+	lease, err := s.lease(context.Background())
+	require.NoError(t, err, "expected an org set once a game is over")
+	require.Equal(t, []string{"A", "B"}, lease.orgs)
+}
+
+func TestOrgSchedulerBootstraps(t *testing.T) {
+	s := newOrgScheduler(OrgScheduling{MaxBootstraps: 2}, schedulerOrgSets, nil, newTestMetrics(t))
+	first, err := s.lease(context.Background())
+	require.NoError(t, err)
+	_, err = s.lease(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = s.lease(ctx)
+	require.Equal(t, context.DeadlineExceeded, err, "expected at most 2 bootstraps at once")
+
+	first.bootstrapped()
+	_, err = s.lease(context.Background())
+	require.NoError(t, err, "expected a bootstrap slot once a game is bootstrapped")
+}
+
+func TestOrgSchedulingRejectsInvalid(t *testing.T) {
+	require.NoError(t, OrgScheduling{}.Validate())
+	require.Error(t, OrgScheduling{Policy: "fair"}.Validate())
+	require.Error(t, OrgScheduling{MaxBootstraps: -1}.Validate())
+}
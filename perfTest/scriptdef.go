@@ -0,0 +1,342 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+
+	tfcCC "github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// gameScriptDef describes a game scenario. It is loaded from YAML (or JSON)
+// files, for example:
+//
+//	game: tfc
+//	players:
+//	  - {name: p1, color: RED, thinkTime: {kind: exponential, mean: 2s}}
+//	  - {name: p2, color: BLUE}
+//	  - {name: p3, color: GREEN}
+//	steps:
+//	  - {player: p1, action: join}
+//	  - repeat: 4
+//	    steps:
+//	      - {player: p1, action: roll}
+//	      - {player: p1, action: trade, to: p2, resource: HILL, amount: 2}
+//	      - {player: p1, action: next}
+//	    retry: {maxAttempts: 10, retryable: [conflict, rejected]}
+//	alliances:
+//	  every: 12
+//	  terms:
+//	    - {from: 0, to: 1, resource: HILL, amount: 2}
+type gameScriptDef struct {
+	// Game is the game chaincode the script is played on: ttt or tfc.
+	Game      string       `yaml:"game"`
+	Players   []playerDef  `yaml:"players"`
+	Steps     []stepDef    `yaml:"steps"`
+	Alliances *allianceDef `yaml:"alliances"`
+}
+
+// playerDef names a player of the script. The players are matched, in order,
+// to the orgs the game is played by.
+type playerDef struct {
+	Name string `yaml:"name"`
+	// Color is the TFC player color, e.g. RED.
+	Color string `yaml:"color"`
+	// Mark is the TTT mark, X or O.
+	Mark string `yaml:"mark"`
+	// ThinkTime overrides the think times of the org playing the player.
+	ThinkTime *ThinkTime `yaml:"thinkTime"`
+}
+
+// stepDef is either a single transaction of a player, or a block of steps
+// played Repeat times. The retry policy of a block applies to all its steps
+// which don't define their own.
+type stepDef struct {
+	Player string `yaml:"player"`
+	// Action is one of move (TTT), join, roll, trade or next (TFC).
+	Action   string `yaml:"action"`
+	Position int32  `yaml:"position"`
+	To       string `yaml:"to"`
+	Resource string `yaml:"resource"`
+	Amount   int32  `yaml:"amount"`
+
+	Repeat int       `yaml:"repeat"`
+	Steps  []stepDef `yaml:"steps"`
+
+	Retry *RetryPolicy `yaml:"retry"`
+}
+
+// allianceDef triggers an alliance between two players every Every steps.
+// When Allies is empty, two players are picked at random for each alliance.
+type allianceDef struct {
+	Every  int            `yaml:"every"`
+	Allies []string       `yaml:"allies"`
+	Terms  []allianceTerm `yaml:"terms"`
+}
+
+// allianceTerm is a trade between the allies, referred to by their index.
+type allianceTerm struct {
+	From     int    `yaml:"from"`
+	To       int    `yaml:"to"`
+	Resource string `yaml:"resource"`
+	Amount   int32  `yaml:"amount"`
+}
+
+// loadGameScript reads and validates a game script definition.
+func loadGameScript(scriptPath string) (*gameScriptDef, error) {
+	data, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read game script: %s", err)
+	}
+
+	def := &gameScriptDef{}
+	err = yaml.UnmarshalStrict(data, def)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse game script %s: %s", scriptPath, err)
+	}
+
+	// Building the script for placeholder players catches all naming errors
+	placeholders := make([]*TFCClient, len(def.Players))
+	for i, p := range def.Players {
+		placeholders[i] = &TFCClient{OrgID: p.Name}
+	}
+	_, _, err = def.build(placeholders)
+	if err != nil {
+		return nil, fmt.Errorf("invalid game script %s: %s", scriptPath, err)
+	}
+
+	return def, nil
+}
+
+// ccName returns the name of the game chaincode the script is played on.
+func (def *gameScriptDef) ccName() string {
+	return def.Game
+}
+
+// ccPath returns the path of the game chaincode the script is played on.
+func (def *gameScriptDef) ccPath() string {
+	if def.Game == "ttt" {
+		return tttCCPath
+	}
+	return tfcCCPath
+}
+
+// build creates the script steps and the alliance generator for the given
+// players, matched in order to the players of the definition.
+func (def *gameScriptDef) build(players []*TFCClient) ([]scriptStep, asyncAcriptAllianceGenerator, error) {
+	if def.Game != "ttt" && def.Game != "tfc" {
+		return nil, nil, fmt.Errorf("unknown game %q", def.Game)
+	}
+	if len(players) < len(def.Players) {
+		return nil, nil, fmt.Errorf("script needs %d players, got %d", len(def.Players), len(players))
+	}
+
+	sp := &scriptPlayers{
+		clients:    make(map[string]*TFCClient),
+		colors:     make(map[string]tfcPb.Player),
+		marks:      make(map[string]tttPb.Mark),
+		thinkTimes: make(map[string]*ThinkTime),
+	}
+	for i, p := range def.Players {
+		if _, ok := sp.clients[p.Name]; ok {
+			return nil, nil, fmt.Errorf("duplicate player %q", p.Name)
+		}
+		sp.clients[p.Name] = players[i]
+		sp.order = append(sp.order, p.Name)
+
+		if p.ThinkTime != nil {
+			if _, err := p.ThinkTime.newSampler(); err != nil {
+				return nil, nil, fmt.Errorf("think time of player %q: %s", p.Name, err)
+			}
+			sp.thinkTimes[p.Name] = p.ThinkTime
+		}
+
+		if def.Game == "tfc" {
+			c, ok := tfcPb.Player_value[p.Color]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown color %q for player %q", p.Color, p.Name)
+			}
+			sp.colors[p.Name] = tfcPb.Player(c)
+		} else {
+			m, ok := tttPb.Mark_value[p.Mark]
+			if !ok || tttPb.Mark(m) == tttPb.Mark_E {
+				return nil, nil, fmt.Errorf("unknown mark %q for player %q", p.Mark, p.Name)
+			}
+			sp.marks[p.Name] = tttPb.Mark(m)
+		}
+	}
+
+	steps, err := sp.buildSteps(def.Steps, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var alliances asyncAcriptAllianceGenerator
+	if def.Alliances != nil {
+		if def.Game != "tfc" {
+			return nil, nil, fmt.Errorf("alliances are only supported for tfc games")
+		}
+		alliances, err = sp.buildAlliances(*def.Alliances)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(steps) == 0 {
+		return nil, nil, fmt.Errorf("script has no steps to play")
+	}
+	return steps, alliances, nil
+}
+
+type scriptPlayers struct {
+	order      []string
+	clients    map[string]*TFCClient
+	colors     map[string]tfcPb.Player
+	marks      map[string]tttPb.Mark
+	thinkTimes map[string]*ThinkTime
+}
+
+func (sp *scriptPlayers) player(name string) (*TFCClient, error) {
+	p, ok := sp.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown player %q", name)
+	}
+	return p, nil
+}
+
+func (sp *scriptPlayers) buildSteps(defs []stepDef, retry *RetryPolicy) ([]scriptStep, error) {
+	steps := []scriptStep{}
+	for i, sd := range defs {
+		stepRetry := retry
+		if sd.Retry != nil {
+			if err := sd.Retry.Validate(); err != nil {
+				return nil, fmt.Errorf("step %d: %s", i, err)
+			}
+			stepRetry = sd.Retry
+		}
+
+		if sd.Repeat > 0 || len(sd.Steps) > 0 {
+			if sd.Repeat <= 0 || len(sd.Steps) == 0 || sd.Action != "" {
+				return nil, fmt.Errorf("step %d: a repeat block needs a positive repeat, steps and no action", i)
+			}
+			block, err := sp.buildSteps(sd.Steps, stepRetry)
+			if err != nil {
+				return nil, fmt.Errorf("step %d: %s", i, err)
+			}
+			for r := 0; r < sd.Repeat; r++ {
+				steps = append(steps, block...)
+			}
+			continue
+		}
+
+		step, err := sp.buildStep(sd)
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %s", i, err)
+		}
+		step.retry = stepRetry
+		step.thinkTime = sp.thinkTimes[sd.Player]
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func (sp *scriptPlayers) buildStep(sd stepDef) (scriptStep, error) {
+	p, err := sp.player(sd.Player)
+	if err != nil {
+		return scriptStep{}, err
+	}
+
+	if sd.Action == "move" {
+		mark, ok := sp.marks[sd.Player]
+		if !ok {
+			return scriptStep{}, fmt.Errorf("move is only supported for ttt games")
+		}
+		return scriptStep{
+			message: &tttPb.TrxArgs{
+				Type:        tttPb.TrxType_MOVE,
+				MovePayload: &tttPb.MoveTrxPayload{Position: sd.Position, Mark: mark},
+			},
+			player: p,
+		}, nil
+	}
+
+	color, ok := sp.colors[sd.Player]
+	if !ok {
+		return scriptStep{}, fmt.Errorf("%s is only supported for tfc games", sd.Action)
+	}
+
+	var args *tfcPb.GameContractTrxArgs
+	switch sd.Action {
+	case "join":
+		args = tfcCC.NewArgsBuilder().WithJoinArgs(color).Args()
+	case "roll":
+		args = tfcCC.NewArgsBuilder().WithRollArgs().Args()
+	case "next":
+		args = tfcCC.NewArgsBuilder().WithNextArgs().Args()
+	case "trade":
+		dest, ok := sp.colors[sd.To]
+		if !ok {
+			return scriptStep{}, fmt.Errorf("unknown trade destination %q", sd.To)
+		}
+		res, ok := tfcPb.Resource_value[sd.Resource]
+		if !ok {
+			return scriptStep{}, fmt.Errorf("unknown resource %q", sd.Resource)
+		}
+		args = tfcCC.NewArgsBuilder().WithTradeArgs(color, dest, tfcPb.Resource(res), sd.Amount).Args()
+	default:
+		return scriptStep{}, fmt.Errorf("unknown action %q", sd.Action)
+	}
+
+	return scriptStep{message: args, player: p}, nil
+}
+
+func (sp *scriptPlayers) buildAlliances(ad allianceDef) (asyncAcriptAllianceGenerator, error) {
+	if ad.Every <= 0 {
+		return nil, fmt.Errorf("alliances need a positive step interval")
+	}
+	if len(ad.Allies) != 0 && len(ad.Allies) != 2 {
+		return nil, fmt.Errorf("alliances need exactly two allies, got %v", ad.Allies)
+	}
+	for _, name := range ad.Allies {
+		if _, err := sp.player(name); err != nil {
+			return nil, err
+		}
+	}
+	if len(ad.Terms) == 0 {
+		return nil, fmt.Errorf("alliances need at least one term")
+	}
+	for _, term := range ad.Terms {
+		if term.From < 0 || term.From > 1 || term.To < 0 || term.To > 1 || term.From == term.To {
+			return nil, fmt.Errorf("alliance terms must trade between ally 0 and ally 1")
+		}
+		if _, ok := tfcPb.Resource_value[term.Resource]; !ok {
+			return nil, fmt.Errorf("unknown resource %q", term.Resource)
+		}
+	}
+
+	return func(ctx context.Context, rnd *rand.Rand, i int, gameName string, eOut chan error) {
+		names := ad.Allies
+		if len(names) == 0 {
+			n := rnd.Intn(len(sp.order))
+			names = []string{sp.order[n], sp.order[(n+1)%len(sp.order)]}
+		}
+
+		allies := []*ally{}
+		for _, name := range names {
+			allies = append(allies, &ally{sp.clients[name], sp.colors[name]})
+		}
+
+		terms := []*tfcPb.GameContractTrxArgs{}
+		for _, term := range ad.Terms {
+			terms = append(terms, tfcCC.NewArgsBuilder().
+				WithTradeArgs(allies[term.From].Color, allies[term.To].Color,
+					tfcPb.Resource(tfcPb.Resource_value[term.Resource]), term.Amount).
+				Args())
+		}
+
+		eOut <- makeAndMeasureAlliance(ctx, gameName, uint32(100+i), allies, terms...)
+	}, nil
+}
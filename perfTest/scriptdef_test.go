@@ -0,0 +1,129 @@
+package tfc
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func requireSameScript(t *testing.T, expected, actual []scriptStep) {
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		require.True(t, proto.Equal(expected[i].message, actual[i].message),
+			"step %d: expected %v, got %v", i, expected[i].message, actual[i].message)
+		require.Equal(t, expected[i].player, actual[i].player, "step %d", i)
+	}
+}
+
+func TestScriptDefTTT(t *testing.T) {
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+
+	def, err := loadGameScript("scripts/ttt1.yaml")
+	require.NoError(t, err, "could not load script")
+	require.Equal(t, tttCCPath, def.ccPath())
+
+	script, alGenerator, err := def.build([]*TFCClient{p1, p2})
+	require.NoError(t, err, "could not build script")
+	require.Nil(t, alGenerator)
+	requireSameScript(t, scriptTTT1(p1, p2), script)
+}
+
+func TestScriptDefTFC(t *testing.T) {
+	p1, p2, p3 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}, &TFCClient{OrgID: Player3}
+
+	def, err := loadGameScript("scripts/tfc1.yaml")
+	require.NoError(t, err, "could not load script")
+	require.Equal(t, tfcCCPath, def.ccPath())
+
+	script, alGenerator, err := def.build([]*TFCClient{p1, p2, p3})
+	require.NoError(t, err, "could not build script")
+	require.NotNil(t, alGenerator)
+
+	expected, _ := scriptTFC1(p1, p2, p3)
+	requireSameScript(t, expected, script)
+
+	_, err = checkScript(script, tfcCCPath)
+	require.NoError(t, err, "expected script to be legal")
+}
+
+func TestScriptDefRetry(t *testing.T) {
+	def := &gameScriptDef{}
+	err := yaml.UnmarshalStrict([]byte(`
+game: ttt
+players: [{name: x, mark: X}, {name: o, mark: O}]
+steps:
+  - {player: x, action: move, position: 0}
+  - repeat: 2
+    retry: {maxAttempts: 2}
+    steps:
+      - {player: o, action: move, position: 1}
+      - {player: x, action: move, position: 2, retry: {maxAttempts: 7}}
+`), def)
+	require.NoError(t, err)
+
+	script, _, err := def.build([]*TFCClient{{OrgID: Player1}, {OrgID: Player2}})
+	require.NoError(t, err, "could not build script")
+	require.Len(t, script, 5)
+
+	require.Nil(t, script[0].retry, "expected the step to use the retry policy of the run")
+	for _, i := range []int{1, 3} {
+		require.Equal(t, 2, script[i].retry.MaxAttempts, "expected step %d to use the block policy", i)
+	}
+	for _, i := range []int{2, 4} {
+		require.Equal(t, 7, script[i].retry.MaxAttempts, "expected step %d to use its own policy", i)
+	}
+}
+
+func TestScriptDefRejectsInvalid(t *testing.T) {
+	scripts := map[string]string{
+		"unknown game":    "game: chess",
+		"unknown field":   "game: ttt\nboard: 3x3",
+		"no steps":        "game: ttt\nplayers: [{name: x, mark: X}]\nsteps: []",
+		"unknown player":  "game: ttt\nplayers: [{name: x, mark: X}]\nsteps: [{player: o, action: move}]",
+		"unknown mark":    "game: ttt\nplayers: [{name: x, mark: Y}]",
+		"unknown color":   "game: tfc\nplayers: [{name: p1, color: PINK}]",
+		"unknown action":  "game: tfc\nplayers: [{name: p1, color: RED}]\nsteps: [{player: p1, action: build}]",
+		"move in tfc":     "game: tfc\nplayers: [{name: p1, color: RED}]\nsteps: [{player: p1, action: move}]",
+		"empty repeat":    "game: tfc\nplayers: [{name: p1, color: RED}]\nsteps: [{repeat: 2}]",
+		"unknown ally":    "game: tfc\nplayers: [{name: p1, color: RED}]\nalliances: {every: 3, allies: [p1, p2]}",
+		"no terms":        "game: tfc\nplayers: [{name: p1, color: RED}]\nalliances: {every: 3}",
+		"ttt alliance":    "game: ttt\nplayers: [{name: x, mark: X}]\nalliances: {every: 3}",
+		"unknown trade":   "game: tfc\nplayers: [{name: p1, color: RED}]\nsteps: [{player: p1, action: trade, to: p2}]",
+		"duplicate names": "game: ttt\nplayers: [{name: x, mark: X}, {name: x, mark: O}]",
+		"invalid think":   "game: ttt\nplayers: [{name: x, mark: X, thinkTime: {kind: sometimes}}]",
+		"invalid retry":   "game: ttt\nplayers: [{name: x, mark: X}]\nsteps: [{player: x, action: move, retry: {backoffFactor: 0}}]",
+	}
+
+	for name, content := range scripts {
+		f, err := ioutil.TempFile("", "script*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(content)
+		require.NoError(t, err)
+		f.Close()
+
+		_, err = loadGameScript(f.Name())
+		require.Error(t, err, "expected %s to be rejected", name)
+	}
+}
+
+func TestScriptDefGame(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	exec, err := newScriptExecutor("scripts/ttt1.yaml")
+	require.NoError(t, err, "could not create executor")
+
+	errOut := make(chan (error), 1)
+	metrics := newTestMetrics(t)
+	lease := leaseOrgs([]string{Player1, Player2, Player3}, metrics)
+
+	exec(context.Background(), cfg, "scriptttt", metrics, errOut, lease)
+	require.Empty(t, lease.scheduler.bootstraps, "expected the bootstrap slot to be freed")
+	require.NoError(t, <-errOut)
+}
@@ -0,0 +1,282 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/pkg/errors"
+)
+
+// SimContract is a chaincode simulated in process by the SimLedger.
+type SimContract interface {
+	// Init is called once, when the chaincode is instantiated on a channel.
+	Init(args [][]byte) error
+	// Invoke handles a transaction submitted by the creator org, and returns
+	// the response payload.
+	Invoke(creator string, fcn string, args [][]byte) ([]byte, error)
+}
+
+// simContracts maps chaincode paths to the constructors of the contracts
+// simulating them.
+var simContracts = map[string]func() SimContract{}
+
+// RegisterSimContract makes the SimLedger simulate the chaincode found at
+// ccPath with the contracts returned by newContract.
+func RegisterSimContract(ccPath string, newContract func() SimContract) {
+	simContracts[ccPath] = newContract
+}
+
+// simChannel is a channel of the SimLedger. Its contracts are invoked under
+// the lock of the channel, so transactions of different channels run
+// concurrently, as they do on the network.
+type simChannel struct {
+	lock      sync.Mutex
+	members   map[string]bool
+	contracts map[string]SimContract
+}
+
+// SimLedger is an in-process Ledger. It keeps track of channels, chaincode
+// installations and instantiations the same way the network would, and runs
+// the registered SimContracts instead of the real chaincode, so games can be
+// played without a Fabric network.
+type SimLedger struct {
+	lock         sync.Mutex
+	channels     map[string]*simChannel
+	installed    map[string]map[string]bool
+	preinstalled map[string]bool
+	joined       map[*TFCClient]string
+	nOfTrx       uint64
+}
+
+// NewSimLedger creates an empty simulated ledger. The preinstalled chaincodes
+// are considered installed on the peers of all orgs, the same way the network
+// setup script installs the game chaincodes.
+func NewSimLedger(preinstalled ...string) *SimLedger {
+	sl := &SimLedger{
+		channels:     make(map[string]*simChannel),
+		installed:    make(map[string]map[string]bool),
+		preinstalled: make(map[string]bool),
+		joined:       make(map[*TFCClient]string),
+	}
+	for _, ccName := range preinstalled {
+		sl.preinstalled[ccName] = true
+	}
+	return sl
+}
+
+func (sl *SimLedger) Connect(ctx context.Context, cfg *RunConfig, gameName string, chanOrgs []string) ([]*TFCClient, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	netOrgs, err := cfg.Network.channelOrgs(chanOrgs)
+	if err != nil {
+		return nil, err
+	}
+
+	players := []*TFCClient{}
+	for _, netOrg := range netOrgs {
+		players = append(players, &TFCClient{
+			OrgID:         netOrg.Name,
+			PeerEndpoint:  netOrg.Peers[0].Host,
+			Peers:         netOrg.peerHosts(),
+			Endorser:      netOrg.MSPID + ".member",
+			GameObservers: []*GameObserver{},
+			Ledger:        sl,
+			Network:       cfg.Network,
+			cfg:           cfg,
+		})
+	}
+	return players, nil
+}
+
+func (sl *SimLedger) CreateChannel(ctx context.Context, players []*TFCClient, chanName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	if _, ok := sl.channels[chanName]; ok {
+		return fmt.Errorf("channel %s already exists", chanName)
+	}
+
+	sl.channels[chanName] = &simChannel{
+		members:   make(map[string]bool),
+		contracts: make(map[string]SimContract),
+	}
+	for _, p := range players {
+		sl.channels[chanName].members[p.OrgID] = false
+	}
+	return nil
+}
+
+func (sl *SimLedger) JoinChannel(ctx context.Context, player *TFCClient, chanName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	ch, ok := sl.channels[chanName]
+	if !ok {
+		return fmt.Errorf("channel %s does not exist", chanName)
+	}
+	if _, ok := ch.members[player.OrgID]; !ok {
+		return fmt.Errorf("org %s is not a member of channel %s", player.OrgID, chanName)
+	}
+
+	ch.members[player.OrgID] = true
+	sl.joined[player] = chanName
+	return nil
+}
+
+func (sl *SimLedger) InstallCC(ctx context.Context, players []*TFCClient, ccReq resmgmt.InstallCCRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	for _, p := range players {
+		if sl.installed[p.OrgID] == nil {
+			sl.installed[p.OrgID] = make(map[string]bool)
+		}
+		sl.installed[p.OrgID][ccReq.Name] = true
+	}
+	return nil
+}
+
+func (sl *SimLedger) InstantiateCC(ctx context.Context, players []*TFCClient, chanName string, ccReq resmgmt.InstantiateCCRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	ch, ok := sl.channels[chanName]
+	if !ok {
+		return fmt.Errorf("channel %s does not exist", chanName)
+	}
+	if _, ok := ch.contracts[ccReq.Name]; ok {
+		return fmt.Errorf("chaincode %s already instantiated on channel %s", ccReq.Name, chanName)
+	}
+
+	for _, p := range players {
+		if !ch.members[p.OrgID] {
+			return fmt.Errorf("org %s has not joined channel %s", p.OrgID, chanName)
+		}
+		if !sl.installed[p.OrgID][ccReq.Name] && !sl.preinstalled[ccReq.Name] {
+			return fmt.Errorf("chaincode %s is not installed for org %s", ccReq.Name, p.OrgID)
+		}
+	}
+
+	newContract, ok := simContracts[ccReq.Path]
+	if !ok {
+		return fmt.Errorf("no simulated contract registered for path %s", ccReq.Path)
+	}
+
+	contract := newContract()
+	err := contract.Init(ccReq.Args)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate cc: %s", err)
+	}
+	ch.contracts[ccReq.Name] = contract
+	return nil
+}
+
+func (sl *SimLedger) Execute(ctx context.Context, player *TFCClient, req channel.Request) (channel.Response, TrxPhases, error) {
+	if err := ctx.Err(); err != nil {
+		return channel.Response{}, TrxPhases{}, err
+	}
+
+	sl.lock.Lock()
+	chanName, ok := sl.joined[player]
+	if !ok {
+		sl.lock.Unlock()
+		return channel.Response{}, TrxPhases{}, fmt.Errorf("org %s has not joined any channel", player.OrgID)
+	}
+
+	ch := sl.channels[chanName]
+	contract, ok := ch.contracts[req.ChaincodeID]
+	if !ok {
+		sl.lock.Unlock()
+		return channel.Response{}, TrxPhases{}, fmt.Errorf("chaincode %s is not instantiated on channel %s",
+			req.ChaincodeID, chanName)
+	}
+
+	sl.nOfTrx++
+	trxID := fab.TransactionID(fmt.Sprintf("%s-%d", chanName, sl.nOfTrx))
+	sl.lock.Unlock()
+
+	// Transactions are committed as soon as the contract endorses them
+	ch.lock.Lock()
+	st := time.Now()
+	payload, err := contract.Invoke(player.OrgID, req.Fcn, req.Args)
+	rt := time.Since(st)
+	ch.lock.Unlock()
+	phases := TrxPhases{Endorsement: rt, Total: rt}
+
+	if err != nil {
+		// Chaincode errors are reported the same way the peers do
+		return channel.Response{TransactionID: trxID, ChaincodeStatus: 500}, phases, errors.WithMessage(
+			status.New(status.ChaincodeStatus, 500, err.Error(), nil),
+			fmt.Sprintf("transaction %s returned error", trxID))
+	}
+
+	return channel.Response{
+		TransactionID:   trxID,
+		ChaincodeStatus: 200,
+		Payload:         payload,
+	}, phases, nil
+}
+
+func (sl *SimLedger) Close(player *TFCClient) {
+	sl.lock.Lock()
+	defer sl.lock.Unlock()
+
+	delete(sl.joined, player)
+}
+
+// checkScript plays the script against a fresh instance of the contract
+// simulating the chaincode at ccPath, without any retries. It returns the
+// response payloads of all steps, or an error for the first rejected step.
+func checkScript(script []scriptStep, ccPath string) ([][]byte, error) {
+	newContract, ok := simContracts[ccPath]
+	if !ok {
+		return nil, fmt.Errorf("no simulated contract registered for path %s", ccPath)
+	}
+
+	contract := newContract()
+	err := contract.Init([][]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := [][]byte{}
+	for i, step := range script {
+		trxArgs, err := proto.Marshal(step.message)
+		if err != nil {
+			return payloads, err
+		}
+
+		payload, err := contract.Invoke(step.player.OrgID, "publish", [][]byte{trxArgs})
+		if err != nil {
+			return payloads, fmt.Errorf("step %d %v rejected: %s", i, step.message, err)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	return payloads, nil
+}
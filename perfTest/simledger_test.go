@@ -0,0 +1,154 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/stretchr/testify/require"
+)
+
+type echoContract struct {
+	invocations int
+}
+
+func (ec *echoContract) Init(args [][]byte) error {
+	return nil
+}
+
+func (ec *echoContract) Invoke(creator string, fcn string, args [][]byte) ([]byte, error) {
+	ec.invocations++
+	return []byte(fmt.Sprintf("%s:%s:%s", creator, fcn, args[0])), nil
+}
+
+// blockingContract blocks its invocations until released.
+type blockingContract struct {
+	invoked chan bool
+	release chan bool
+}
+
+func (bc *blockingContract) Init(args [][]byte) error {
+	return nil
+}
+
+func (bc *blockingContract) Invoke(creator string, fcn string, args [][]byte) ([]byte, error) {
+	bc.invoked <- true
+	<-bc.release
+	return nil, nil
+}
+
+var blocking = &blockingContract{invoked: make(chan bool, 1), release: make(chan bool)}
+
+func init() {
+	RegisterSimContract("sim/echo", func() SimContract { return &echoContract{} })
+	RegisterSimContract("sim/blocking", func() SimContract { return blocking })
+}
+
+// simRunConfig makes games bootstrap on a simulated ledger, with the
+// chaincodes preinstalled.
+func simRunConfig(preinstalled ...string) *RunConfig {
+	cfg := DefaultRunConfig()
+	cfg.Ledger = NewSimLedger(preinstalled...)
+	return cfg
+}
+
+// newTestMetrics creates unregistered player metrics.
+func newTestMetrics(t *testing.T) *PlayerMetrics {
+	metrics, err := NewPlayerMetrics(DefaultMetricsConfig())
+	require.NoError(t, err, "could not create metrics")
+	return metrics
+}
+
+func TestSimLedgerConnect(t *testing.T) {
+	cfg := DefaultRunConfig()
+	cfg.Network = Network{Domain: "example.com", PeersPerOrg: 2, Orgs: []NetworkOrg{
+		{Name: "Org1", MSPID: "FirstMSP"},
+		{Name: "Org2", MSPID: "SecondMSP", Domain: "second.org", Peers: []NetworkPeer{{Host: "peer.second.org"}}},
+	}}.withDefaults()
+
+	players, err := NewSimLedger().Connect(context.Background(), cfg, "net1", []string{"Org1", "Org2"})
+	require.NoError(t, err, "could not connect players")
+	require.Equal(t, "peer0.org1.example.com", players[0].PeerEndpoint)
+	require.Equal(t, []string{"peer0.org1.example.com", "peer1.org1.example.com"}, players[0].Peers)
+	require.Equal(t, "FirstMSP.member", players[0].Endorser)
+	require.Equal(t, []string{"peer.second.org"}, players[1].Peers)
+	require.Equal(t, "SecondMSP.member", players[1].Endorser)
+
+	_, err = NewSimLedger().Connect(context.Background(), cfg, "net2", []string{"Org1", Player3})
+	require.Error(t, err, "expected orgs outside the network to be rejected")
+}
+
+func TestSimLedgerStartGame(t *testing.T) {
+	ledger := NewSimLedger()
+	players, err := ledger.Connect(context.Background(), DefaultRunConfig(), "echo1", []string{Player1, Player2})
+	require.NoError(t, err, "could not connect players")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "echo", Path: "sim/echo", Version: "1.0"}
+	err = deployChaincode(context.Background(), ccReq.Path, ccReq.Name, players)
+	require.NoError(t, err, "could not deploy chaincode")
+
+	err = startGame(context.Background(), players, "echo1", ccReq)
+	require.NoError(t, err, "could not start game")
+
+	r, phases, err := invokeGameChaincode(context.Background(), players[1], "echo", []byte("move"))
+	require.NoError(t, err, "could not invoke chaincode")
+	require.Equal(t, "Player2:publish:move", string(r.Payload))
+	require.NotEmpty(t, r.TransactionID)
+	require.Equal(t, phases.Endorsement, phases.Total)
+
+	closePlayers(players)
+	_, _, err = invokeGameChaincode(context.Background(), players[1], "echo", []byte("move"))
+	require.Error(t, err, "expected invoke to fail after closing the players")
+}
+
+func TestSimLedgerRejectsUninstalledCC(t *testing.T) {
+	ledger := NewSimLedger()
+	players, err := ledger.Connect(context.Background(), DefaultRunConfig(), "echo2", []string{Player1, Player2})
+	require.NoError(t, err, "could not connect players")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "echo", Path: "sim/echo", Version: "1.0"}
+	err = startGame(context.Background(), players, "echo2", ccReq)
+	require.Error(t, err, "expected instantiate to fail without install")
+
+	_, _, err = invokeGameChaincode(context.Background(), players[0], "echo", []byte("move"))
+	require.Error(t, err, "expected invoke to fail without instantiate")
+}
+
+func TestSimLedgerRejectsDuplicateChannel(t *testing.T) {
+	ledger := NewSimLedger()
+	players, err := ledger.Connect(context.Background(), DefaultRunConfig(), "echo3", []string{Player1, Player2})
+	require.NoError(t, err, "could not connect players")
+
+	require.NoError(t, ledger.CreateChannel(context.Background(), players, "echo3"))
+	require.Error(t, ledger.CreateChannel(context.Background(), players, "echo3"))
+
+	outsider, err := ledger.Connect(context.Background(), DefaultRunConfig(), "echo3", []string{Player3})
+	require.NoError(t, err, "could not connect players")
+	require.Error(t, ledger.JoinChannel(context.Background(), outsider[0], "echo3"))
+}
+
+func TestSimLedgerRunsChannelsConcurrently(t *testing.T) {
+	ledger := NewSimLedger("echo", "blocking")
+	start := func(gameName string, ccReq resmgmt.InstantiateCCRequest) []*TFCClient {
+		players, err := ledger.Connect(context.Background(), DefaultRunConfig(), gameName, []string{Player1, Player2})
+		require.NoError(t, err, "could not connect players")
+		require.NoError(t, startGame(context.Background(), players, gameName, ccReq), "could not start game")
+		return players
+	}
+	blocked := start("blocked1", resmgmt.InstantiateCCRequest{Name: "blocking", Path: "sim/blocking", Version: "1.0"})
+	echo := start("echo4", resmgmt.InstantiateCCRequest{Name: "echo", Path: "sim/echo", Version: "1.0"})
+
+	done := make(chan error)
+	go func() {
+		_, _, err := invokeGameChaincode(context.Background(), blocked[0], "blocking", []byte("move"))
+		done <- err
+	}()
+	<-blocking.invoked
+
+	_, _, err := invokeGameChaincode(context.Background(), echo[0], "echo", []byte("move"))
+	require.NoError(t, err, "a blocked channel should not block the others")
+
+	blocking.release <- true
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,351 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// StageGame is an executor in the mix of a stage. Executor is one of ttt,
+// tfc or drm, or the path of a game script definition. Games are started
+// with the executors in proportion to their Weight.
+type StageGame struct {
+	Executor string `yaml:"executor"`
+	Weight   int    `yaml:"weight"`
+	// Orgs overrides the org pool of the stage for the games of the executor.
+	Orgs [][]string `yaml:"orgs"`
+}
+
+// Stage plays games with a fixed concurrency, either until Games games were
+// started, or until Duration elapsed. The org sets of the pools are leased to
+// the games as decided by the Scheduling. Games still running at the end of
+// the stage are waited for.
+type Stage struct {
+	// Name labels the metrics and run records of the stage, and is part of
+	// the names of its games.
+	Name        string        `yaml:"name"`
+	Games       int           `yaml:"games"`
+	Duration    time.Duration `yaml:"duration"`
+	Concurrency int           `yaml:"concurrency"`
+	Mix         []StageGame   `yaml:"mix"`
+	// Orgs is the org pool of the stage. It defaults to the org sets of the
+	// network of the run.
+	Orgs       [][]string    `yaml:"orgs"`
+	Scheduling OrgScheduling `yaml:"scheduling"`
+}
+
+// StagePlan is a series of stages, played in order. The plan stops at the
+// first stage with failed games, for example:
+//
+//	stages:
+//	  - {name: warmup, games: 4, concurrency: 2, mix: [{executor: ttt, weight: 1}]}
+//	  - name: peak
+//	    duration: 10m
+//	    concurrency: 16
+//	    scheduling: {policy: exclusive, maxBootstraps: 4}
+//	    mix:
+//	      - {executor: ttt, weight: 3}
+//	      - {executor: scripts/tfc1.yaml, weight: 1, orgs: [[Player1, Player2, Player3]]}
+type StagePlan struct {
+	Stages []Stage `yaml:"stages"`
+}
+
+// staticStages plays 4 concurrent TFC games.
+var staticStages = StagePlan{Stages: []Stage{
+	{Name: "static", Games: 4, Concurrency: 4, Mix: []StageGame{{Executor: "tfc", Weight: 1}}},
+}}
+
+// incrementalStages doubles the number of concurrent games from 2 to 16, with
+// one TTT game more, and one TFC game less, than half of them. The TFC games
+// are played by the first half of the org sets of the network, and the TTT
+// games by the rest.
+func incrementalStages(network Network) StagePlan {
+	orgSets := network.OrgSets
+	return StagePlan{Stages: []Stage{
+		incrementalStage(2, orgSets), incrementalStage(4, orgSets),
+		incrementalStage(8, orgSets), incrementalStage(16, orgSets),
+	}}
+}
+
+func incrementalStage(nOfRoutines int, orgSets [][]string) Stage {
+	split := len(orgSets) / 2
+	return Stage{
+		Name:        fmt.Sprintf("c%d", nOfRoutines),
+		Games:       nOfRoutines,
+		Concurrency: nOfRoutines,
+		Mix: []StageGame{
+			{Executor: "ttt", Weight: nOfRoutines/2 + 1, Orgs: orgSets[split:]},
+			{Executor: "tfc", Weight: nOfRoutines/2 - 1, Orgs: orgSets[:split]},
+		},
+	}
+}
+
+// spikeStages plays a few TTT games at a time, then 16 concurrent TTT and TFC
+// games, and then a few TTT games again.
+var spikeStages = StagePlan{Stages: []Stage{
+	{Name: "base", Games: 4, Concurrency: 2, Mix: []StageGame{{Executor: "ttt", Weight: 1}}},
+	{Name: "spike", Games: 16, Concurrency: 16, Mix: []StageGame{{Executor: "ttt", Weight: 1}, {Executor: "tfc", Weight: 1}}},
+	{Name: "recovery", Games: 4, Concurrency: 2, Mix: []StageGame{{Executor: "ttt", Weight: 1}}},
+}}
+
+// stageExecutors are the built-in executors of the stages, with the number of
+// orgs their games are played by.
+var stageExecutors = map[string]struct {
+	exec    asyncExecutor
+	nOfOrgs int
+}{
+	"ttt": {execTTTGameAsync, 2},
+	"tfc": {execTFCGameAsync, 3},
+	"drm": {execDRMAsync, 2},
+}
+
+// stageExecutor returns the built-in executor, or an executor of the game
+// script definition at the path.
+func stageExecutor(name string) (asyncExecutor, int, error) {
+	if se, ok := stageExecutors[name]; ok {
+		return se.exec, se.nOfOrgs, nil
+	}
+
+	def, err := loadGameScript(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unknown executor %q: %s", name, err)
+	}
+	exec, err := newScriptExecutor(name)
+	return exec, len(def.Players), err
+}
+
+// LoadStagePlan reads a stage plan, and validates it for the network.
+func LoadStagePlan(planPath string, network Network) (StagePlan, error) {
+	data, err := ioutil.ReadFile(planPath)
+	if err != nil {
+		return StagePlan{}, fmt.Errorf("could not read stage plan: %s", err)
+	}
+
+	sp := StagePlan{}
+	err = yaml.UnmarshalStrict(data, &sp)
+	if err != nil {
+		return StagePlan{}, fmt.Errorf("could not parse stage plan %s: %s", planPath, err)
+	}
+	if err := sp.Validate(network); err != nil {
+		return StagePlan{}, fmt.Errorf("invalid stage plan %s: %s", planPath, err)
+	}
+	return sp, nil
+}
+
+// Experiment returns the experiment playing the stages.
+func (sp StagePlan) Experiment() Experiment {
+	return sp.run
+}
+
+var stageName = regexp.MustCompile("^[a-z0-9]+$")
+
+// Validate checks the stages, and that their executors can be created on the
+// network.
+func (sp StagePlan) Validate(network Network) error {
+	if len(sp.Stages) == 0 {
+		return fmt.Errorf("stage plan has no stages")
+	}
+	names := map[string]bool{}
+	for _, st := range sp.Stages {
+		if names[st.Name] {
+			return fmt.Errorf("duplicate stage %q", st.Name)
+		}
+		names[st.Name] = true
+
+		if _, err := st.executors(network); err != nil {
+			return fmt.Errorf("stage %s: %s", st.Name, err)
+		}
+	}
+	return nil
+}
+
+// stageGame is an executor of a stage, with the org pool of its games.
+type stageGame struct {
+	exec    asyncExecutor
+	weight  int
+	orgSets [][]string
+	// pool identifies the org pool, the games of the same pool share its
+	// scheduler
+	pool string
+}
+
+// executors checks the stage, and creates the executors of its mix, playing
+// on the network unless the stage has its own org pool.
+func (st Stage) executors(network Network) ([]stageGame, error) {
+	if !stageName.MatchString(st.Name) {
+		return nil, fmt.Errorf("stage name must be lower case letters and digits, got %q", st.Name)
+	}
+	if (st.Games > 0) == (st.Duration > 0) {
+		return nil, fmt.Errorf("stage needs either a number of games or a duration")
+	}
+	if st.Games < 0 || st.Duration < 0 {
+		return nil, fmt.Errorf("stage can not have negative games or duration")
+	}
+	if st.Concurrency < 1 {
+		return nil, fmt.Errorf("stage needs a concurrency of at least 1, got %d", st.Concurrency)
+	}
+	if err := st.Scheduling.Validate(); err != nil {
+		return nil, err
+	}
+
+	stagePool := st.Orgs
+	if len(stagePool) == 0 {
+		stagePool = network.OrgSets
+	}
+
+	games := []stageGame{}
+	totalWeight := 0
+	for _, sg := range st.Mix {
+		if sg.Weight < 0 {
+			return nil, fmt.Errorf("executor %s can not have a negative weight", sg.Executor)
+		}
+		totalWeight += sg.Weight
+
+		exec, nOfOrgs, err := stageExecutor(sg.Executor)
+		if err != nil {
+			return nil, err
+		}
+
+		orgSets := sg.Orgs
+		if len(orgSets) == 0 {
+			orgSets = stagePool
+		}
+		for _, orgs := range orgSets {
+			if len(orgs) < nOfOrgs {
+				return nil, fmt.Errorf("executor %s needs %d orgs, got %v", sg.Executor, nOfOrgs, orgs)
+			}
+		}
+		games = append(games, stageGame{exec: exec, weight: sg.Weight, orgSets: orgSets, pool: fmt.Sprint(orgSets)})
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("stage needs an executor with a positive weight")
+	}
+	return games, nil
+}
+
+// mixPicker picks the executors in proportion to their weights, spread as
+// evenly as possible: it is a smooth weighted round-robin.
+type mixPicker struct {
+	games   []stageGame
+	current []int
+	total   int
+}
+
+func newMixPicker(games []stageGame) *mixPicker {
+	mp := &mixPicker{games: games, current: make([]int, len(games))}
+	for _, g := range games {
+		mp.total += g.weight
+	}
+	return mp
+}
+
+func (mp *mixPicker) next() stageGame {
+	best := 0
+	for i, g := range mp.games {
+		mp.current[i] += g.weight
+		if mp.current[i] > mp.current[best] {
+			best = i
+		}
+	}
+	mp.current[best] -= mp.total
+	return mp.games[best]
+}
+
+// run plays the stages in order, observing into metrics labelled with the
+// stage names.
+func (sp StagePlan) run(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+	if err := sp.Validate(cfg.Network); err != nil {
+		return err
+	}
+
+	for _, st := range sp.Stages {
+		err := st.run(ctx, cfg, runName, metrics.WithStage(st.Name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run plays the games of the stage. Games are started once a slot is free,
+// and their org pool leases them an org set. The failures of all games are
+// returned together, as GameErrors.
+func (st Stage) run(ctx context.Context, cfg *RunConfig, runName string, metrics *PlayerMetrics) error {
+	games, err := st.executors(cfg.Network)
+	if err != nil {
+		return err
+	}
+	picker := newMixPicker(games)
+
+	schedulers := map[string]*orgScheduler{}
+	for _, g := range games {
+		if _, ok := schedulers[g.pool]; !ok {
+			rnd := cfg.gameRand(runName + st.Name + g.pool)
+			schedulers[g.pool] = newOrgScheduler(st.Scheduling, g.orgSets, rnd, metrics)
+		}
+	}
+
+	log.Printf(" ############# \n\t Starting stage *%s* of run *%s* with concurrency %v. \n ##############",
+		st.Name, runName, st.Concurrency)
+
+	slots := make(chan struct{}, st.Concurrency)
+	deadline := time.Now().Add(st.Duration)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	failures := GameErrors{}
+
+	started := 0
+	for ; st.Games == 0 || started < st.Games; started++ {
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() != nil || (st.Duration > 0 && time.Now().After(deadline)) {
+			break
+		}
+
+		g := picker.next()
+		lease, err := schedulers[g.pool].lease(ctx)
+		if err != nil {
+			break
+		}
+
+		gameName := fmt.Sprintf("%s%s-%d", runName, st.Name, started+1)
+		errOut := make(chan (error), 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.exec(ctx, cfg, gameName, metrics, errOut, lease)
+			err := <-errOut
+			lease.release()
+			cfg.finishGameArtifacts(gameName, err)
+			<-slots
+
+			if err != nil {
+				log.Printf("Game failed: %s", err)
+				lock.Lock()
+				failures = append(failures, err)
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, s := range schedulers {
+		s.logLoad(st.Name)
+	}
+
+	log.Printf(" ############# \n\t Finished stage *%s* of run *%s* after %d games. \n ##############",
+		st.Name, runName, started)
+
+	if len(failures) == 0 && ctx.Err() != nil {
+		return fmt.Errorf("stage %s interrupted after %d games: %s", st.Name, started, ctx.Err())
+	}
+	return failures.errOrNil()
+}
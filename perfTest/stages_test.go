@@ -0,0 +1,173 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMixPicker(t *testing.T) {
+	games := []stageGame{{weight: 5}, {weight: 0}, {weight: 3}}
+	picker := newMixPicker(games)
+
+	picked := map[int]int{}
+	for i := 0; i < 8; i++ {
+		g := picker.next()
+		picked[g.weight]++
+	}
+	require.Equal(t, map[int]int{5: 5, 3: 3}, picked, "expected the games in proportion to the weights")
+}
+
+func TestIncrementalStagesSplit(t *testing.T) {
+	network := DefaultNetwork()
+	for _, st := range incrementalStages(network).Stages {
+		games, err := st.executors(network)
+		require.NoError(t, err)
+
+		picker := newMixPicker(games)
+		ttt := 0
+		for i := 0; i < st.Games; i++ {
+			if picker.next().pool == games[0].pool {
+				ttt++
+			}
+		}
+		require.Equal(t, st.Games/2+1, ttt, "wrong number of TTT games in stage %s", st.Name)
+	}
+}
+
+func TestStagePlanRejectsInvalid(t *testing.T) {
+	network := DefaultNetwork()
+	for name, plan := range map[string]StagePlan{"static": staticStages, "incremental": incrementalStages(network), "spike": spikeStages} {
+		require.NoError(t, plan.Validate(network), "expected the %s stages to be valid", name)
+	}
+
+	ttt := []StageGame{{Executor: "ttt", Weight: 1}}
+	plans := map[string]StagePlan{
+		"no stages":        {},
+		"bad name":         {Stages: []Stage{{Name: "Warm Up", Games: 1, Concurrency: 1, Mix: ttt}}},
+		"duplicate name":   {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1, Mix: ttt}, {Name: "a", Games: 1, Concurrency: 1, Mix: ttt}}},
+		"games and time":   {Stages: []Stage{{Name: "a", Games: 1, Duration: time.Second, Concurrency: 1, Mix: ttt}}},
+		"no end":           {Stages: []Stage{{Name: "a", Concurrency: 1, Mix: ttt}}},
+		"no concurrency":   {Stages: []Stage{{Name: "a", Games: 1, Mix: ttt}}},
+		"no mix":           {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1}}},
+		"zero weights":     {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1, Mix: []StageGame{{Executor: "ttt"}}}}},
+		"unknown executor": {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1, Mix: []StageGame{{Executor: "chess", Weight: 1}}}}},
+		"small org set": {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1,
+			Mix: []StageGame{{Executor: "tfc", Weight: 1, Orgs: [][]string{{Player1, Player2}}}}}}},
+		"unknown policy": {Stages: []Stage{{Name: "a", Games: 1, Concurrency: 1, Mix: ttt,
+			Scheduling: OrgScheduling{Policy: "fair"}}}},
+	}
+	for name, plan := range plans {
+		require.Error(t, plan.Validate(network), "expected %s to be rejected", name)
+	}
+}
+
+func TestLoadStagePlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stages")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	planPath := filepath.Join(dir, "stages.yaml")
+	require.NoError(t, ioutil.WriteFile(planPath, []byte(`
+stages:
+  - {name: base, games: 4, concurrency: 2, mix: [{executor: ttt, weight: 1}]}
+  - name: spike
+    duration: 5m
+    concurrency: 16
+    orgs: [[Player1, Player2, Player3]]
+    mix:
+      - {executor: ttt, weight: 1}
+      - {executor: scripts/tfc1.yaml, weight: 2}
+`), 0644))
+
+	sp, err := LoadStagePlan(planPath, DefaultNetwork())
+	require.NoError(t, err, "could not load stage plan")
+	require.Len(t, sp.Stages, 2)
+	require.Equal(t, 5*time.Minute, sp.Stages[1].Duration)
+	require.Equal(t, StageGame{Executor: "scripts/tfc1.yaml", Weight: 2}, sp.Stages[1].Mix[1])
+
+	require.NoError(t, ioutil.WriteFile(planPath, []byte("stages: [{name: base, games: 4}]"), 0644))
+	_, err = LoadStagePlan(planPath, DefaultNetwork())
+	require.Error(t, err, "expected the stage without concurrency to be rejected")
+}
+
+func TestStageAggregatesFailures(t *testing.T) {
+	// Games with an odd number fail
+	stageExecutors["flaky"] = struct {
+		exec    asyncExecutor
+		nOfOrgs int
+	}{func(ctx context.Context, cfg *RunConfig, gameName string, metrics *PlayerMetrics, errOut chan (error), lease *orgLease) {
+		orgs := lease.orgs
+		lease.bootstrapped()
+		if n := gameName[len(gameName)-1]; (n-'0')%2 == 1 {
+			errOut <- newGameError(ScriptPhase, gameName, strings.Join(orgs, ","), fmt.Errorf("rejected"))
+			return
+		}
+		errOut <- nil
+	}, 1}
+	defer delete(stageExecutors, "flaky")
+
+	stage := func(games int) Stage {
+		return Stage{Name: "flaky", Games: games, Concurrency: 2, Mix: []StageGame{{Executor: "flaky", Weight: 1}}}
+	}
+	cfg := DefaultRunConfig()
+
+	err := stage(4).run(context.Background(), cfg, "agg", newTestMetrics(t))
+	require.IsType(t, GameErrors{}, err)
+	require.Len(t, err.(GameErrors), 2, "expected every failed game to be reported once")
+	require.True(t, strings.HasPrefix(err.Error(), "2 games failed: "))
+
+	err = stage(1).run(context.Background(), cfg, "agg", newTestMetrics(t))
+	require.Error(t, err)
+
+	plan := StagePlan{Stages: []Stage{stage(1), {Name: "never", Games: 1, Concurrency: 1,
+		Mix: []StageGame{{Executor: "chess", Weight: 1}}}}}
+	err = plan.run(context.Background(), cfg, "agg", newTestMetrics(t))
+	require.Error(t, err)
+}
+
+func TestStagePlanSim(t *testing.T) {
+	cfg := simRunConfig("ttt")
+	cfg.ThinkTimes = ThinkTimes{Default: ThinkTime{Kind: "constant"}}
+
+	dir, err := ioutil.TempDir("", "stages")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "run.jsonl")
+	rl, err := NewRunLog(logPath)
+	require.NoError(t, err, "could not create run log")
+	metrics := newTestMetrics(t)
+	metrics.RunLog = rl
+
+	plan := StagePlan{Stages: []Stage{
+		{Name: "warmup", Games: 1, Concurrency: 1, Mix: []StageGame{{Executor: "ttt", Weight: 1}}},
+		{Name: "peak", Games: 4, Concurrency: 4, Orgs: [][]string{{Player1, Player2}, {Player3, Player4}},
+			Mix: []StageGame{{Executor: "ttt", Weight: 1}, {Executor: "scripts/ttt1.yaml", Weight: 1}}},
+	}}
+	require.NoError(t, plan.run(context.Background(), cfg, "simstages", metrics))
+	require.NoError(t, rl.Close())
+
+	records, err := ReadRunLog(logPath)
+	require.NoError(t, err, "could not read run log")
+
+	games := map[string]map[string]bool{}
+	for _, rec := range records {
+		require.True(t, rec.Success, "expected all operations to succeed, got %v", rec)
+		if games[rec.Stage] == nil {
+			games[rec.Stage] = map[string]bool{}
+		}
+		games[rec.Stage][rec.Game] = true
+	}
+	require.Equal(t, map[string]map[string]bool{
+		"warmup": {"simstageswarmup-1": true},
+		"peak":   {"simstagespeak-1": true, "simstagespeak-2": true, "simstagespeak-3": true, "simstagespeak-4": true},
+	}, games)
+}
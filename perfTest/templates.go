@@ -0,0 +1,534 @@
+package tfc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fabricTemplate is a template bundled into the binary, and the check of the
+// files rendered from it.
+type fabricTemplate struct {
+	text     string
+	validate func(rendered []byte) error
+}
+
+// fabricTemplates are the bundled templates, by name.
+var fabricTemplates = map[string]fabricTemplate{
+	"pConfig.yaml_template":  {clientConfigTemplate, validateClientConfig},
+	"configtx.yaml_template": {configtxTemplate, validateConfigtx},
+}
+
+// CheckTemplates checks that the templates of the dir override bundled
+// templates, and that they parse.
+func CheckTemplates(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read template dir: %s", err)
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), "_template") {
+			continue
+		}
+		if _, ok := fabricTemplates[f.Name()]; !ok {
+			return fmt.Errorf("template %s does not override a bundled template", path.Join(dir, f.Name()))
+		}
+		if _, err := loadTemplate(dir, f.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTemplate parses the template of the dir, or the bundled one if the dir
+// does not override it. Executing the template fails on missing keys.
+func loadTemplate(dir, tplName string) (*template.Template, error) {
+	tpl, ok := fabricTemplates[tplName]
+	if !ok {
+		return nil, fmt.Errorf("unknown template %s", tplName)
+	}
+
+	text, source := tpl.text, "bundled"
+	if dir != "" {
+		tplPath := path.Join(dir, tplName)
+		data, err := ioutil.ReadFile(tplPath)
+		if err == nil {
+			text, source = string(data), tplPath
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not read template: %s", err)
+		}
+	}
+
+	tmpl, err := template.New(tplName).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s template %s: %s", source, tplName, err)
+	}
+	return tmpl, nil
+}
+
+// executeTemplate renders the template, overridden by the one in templateDir
+// if there is one, into the file, if the rendered file passes the check of
+// the template.
+func executeTemplate(templateDir, filePath, tplName string, data interface{}) error {
+	tmpl, err := loadTemplate(templateDir, tplName)
+	if err != nil {
+		return err
+	}
+
+	rendered := &bytes.Buffer{}
+	err = tmpl.Execute(rendered, data)
+	if err != nil {
+		return fmt.Errorf("could not render template: %s", err)
+	}
+	err = fabricTemplates[tplName].validate(rendered.Bytes())
+	if err != nil {
+		return fmt.Errorf("invalid %s rendered from %s: %s", path.Base(filePath), tplName, err)
+	}
+
+	err = ioutil.WriteFile(filePath, rendered.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not create file. %s", err)
+	}
+	return nil
+}
+
+// clientConfig is the part of the client config the SDK can not do without.
+type clientConfig struct {
+	Client struct {
+		Organization string `yaml:"organization"`
+	} `yaml:"client"`
+	Organizations map[string]struct {
+		Peers []string `yaml:"peers"`
+		CAs   []string `yaml:"certificateAuthorities"`
+	} `yaml:"organizations"`
+	Orderers map[string]struct {
+		URL string `yaml:"url"`
+	} `yaml:"orderers"`
+	Peers map[string]struct {
+		URL string `yaml:"url"`
+	} `yaml:"peers"`
+	CAs map[string]struct {
+		URL string `yaml:"url"`
+	} `yaml:"certificateAuthorities"`
+	Channels map[string]struct {
+		Peers map[string]interface{} `yaml:"peers"`
+	} `yaml:"channels"`
+}
+
+// validateClientConfig checks that the client config defines the org of the
+// client, its CAs, the orderers, and every peer it refers to.
+func validateClientConfig(rendered []byte) error {
+	cfg := clientConfig{}
+	err := yaml.Unmarshal(rendered, &cfg)
+	if err != nil {
+		return fmt.Errorf("could not parse client config: %s", err)
+	}
+
+	org, ok := cfg.Organizations[cfg.Client.Organization]
+	if !ok {
+		return fmt.Errorf("client org %q is not defined", cfg.Client.Organization)
+	}
+	for _, ca := range org.CAs {
+		if cfg.CAs[ca].URL == "" {
+			return fmt.Errorf("CA %s of the client org has no url", ca)
+		}
+	}
+	if len(cfg.Orderers) == 0 {
+		return fmt.Errorf("no orderers are defined")
+	}
+	for name, o := range cfg.Orderers {
+		if o.URL == "" {
+			return fmt.Errorf("orderer %s has no url", name)
+		}
+	}
+
+	peers := []string{}
+	for _, o := range cfg.Organizations {
+		peers = append(peers, o.Peers...)
+	}
+	for _, c := range cfg.Channels {
+		for p := range c.Peers {
+			peers = append(peers, p)
+		}
+	}
+	for _, p := range peers {
+		if cfg.Peers[p].URL == "" {
+			return fmt.Errorf("peer %s has no url", p)
+		}
+	}
+	return nil
+}
+
+// validateConfigtx checks that the game channel profile of the configtx can
+// be built.
+func validateConfigtx(rendered []byte) error {
+	_, err := parseChannelProfile(rendered, gameChannelProfile)
+	return err
+}
+
+// clientConfigTemplate is the client config of a player, rendered from
+// pConfigData.
+const clientConfigTemplate = `#
+# Copyright 2019 Stefan Prisca
+#
+# The file is a copy of the Hyperledger e2e configuration found at
+# < https://github.com/hyperledger/fabric-sdk-go/blob/master/test/fixtures/config/config_e2e.yaml >
+
+version: 0.0.0
+
+client:
+  organization: {{.For.Name}}
+
+  logging:
+    level: info
+  cryptoconfig:
+    path: {{.Network.CryptoPath}}/
+
+  credentialStore:
+    path: "/tmp/state-store"
+
+    cryptoStore:
+      path: /tmp/msp
+
+  BCCSP:
+    security:
+     enabled: true
+     default:
+      provider: "SW"
+     hashAlgorithm: "SHA2"
+     softVerify: true
+     level: 256
+
+  tlsCerts:
+    systemCertPool: true
+
+    client:
+      key:
+        path: {{.For.CryptoPath}}/users/{{.Network.User}}@{{.For.Domain}}/tls/client.key
+      cert:
+        path: {{.For.CryptoPath}}/users/{{.Network.User}}@{{.For.Domain}}/tls/client.crt
+
+organizations:
+{{range .Network.Orgs}}
+  {{.Name}}:
+    mspid: {{.MSPID}}
+    cryptoPath:  {{.CryptoPath}}/users/{username}@{{.Domain}}/msp
+    peers:
+{{range .Peers}}
+      - {{.Host}}
+{{end}}
+    certificateAuthorities:
+      - {{.CA}}
+{{end}}
+  Orderer:
+      mspID: {{.Network.OrdererMSPID}}
+      cryptoPath: {{.Network.OrdererCryptoPath}}/users/{username}@{{.Network.Domain}}/msp
+
+
+orderers:
+{{range .Network.Orderers}}
+  {{.Host}}:
+    url: {{.Host}}:{{.HostPort}}
+
+    grpcOptions:
+      ssl-target-name-override: {{.Host}}
+      keep-alive-time: 0s
+      keep-alive-timeout: 20s
+      keep-alive-permit: false
+      fail-fast: false
+      allow-insecure: false
+
+    tlsCACerts:
+      path: {{$.Network.OrdererCryptoPath}}/tlsca/tlsca.{{$.Network.Domain}}-cert.pem
+{{end}}
+
+peers:
+{{range $org := .Network.Orgs}}
+{{range .Peers}}
+  {{.Host}}:
+    url: {{.Host}}:{{.HostPort}}
+    grpcOptions:
+      ssl-target-name-override: {{.Host}}
+      keep-alive-time: 0s
+      keep-alive-timeout: 20s
+      keep-alive-permit: false
+      fail-fast: false
+      allow-insecure: false
+
+    tlsCACerts:
+      path: {{$org.CryptoPath}}/tlsca/tlsca.{{$org.Domain}}-cert.pem
+{{end}}
+{{end}}
+
+certificateAuthorities:
+
+{{range .Orgs}}
+  {{.CA}}:
+    url: {{.CAURL}}
+    tlsCACerts:
+      path: {{.CryptoPath}}/tlsca/tlsca.{{.Domain}}-cert.pem
+      client:
+        key:
+          path: {{.CryptoPath}}/users/{{$.Network.User}}@{{.Domain}}/tls/client.key
+        cert:
+          path: {{.CryptoPath}}/users/{{$.Network.User}}@{{.Domain}}/tls/client.crt
+
+    registrar:
+      enrollId: admin
+      enrollSecret: adminpw
+    caName: {{.CAName}}
+{{end}}
+
+
+entityMatchers:
+  peer:
+{{range .Network.Orgs}}
+{{range .Peers}}
+    - pattern: (\w*){{.Host}}(\w*)
+      urlSubstitutionExp: localhost:{{.HostPort}}
+      sslTargetOverrideUrlSubstitutionExp: {{.Host}}
+      mappedHost: {{.Host}}
+{{end}}
+{{end}}
+
+  orderer:
+{{range .Network.Orderers}}
+    - pattern: (\w*){{.Host}}(\w*)
+      urlSubstitutionExp: localhost:{{.HostPort}}
+      sslTargetOverrideUrlSubstitutionExp: {{.Host}}
+      mappedHost: {{.Host}}
+{{end}}
+
+
+channels:
+
+  _default:
+
+    peers:
+    {{range .Orgs}}
+    {{range .Peers}}
+      {{.Host}}:
+        endorsingPeer: true
+        chaincodeQuery: true
+        ledgerQuery: true
+        eventSource: true
+    {{end}}
+    {{end}}
+    policies:
+
+      discovery:
+        maxTargets: 1
+        retryOpts:
+          attempts: 5
+          initialBackoff: 100ms
+          maxBackoff: 4s
+          backoffFactor: 2.0
+
+      selection:
+        SortingStrategy: PreferOrg
+        Balancer: Random
+        BlockHeightLagThreshold: 10
+
+      queryChannelConfig:
+        minResponses: 1
+        maxTargets: 1
+        retryOpts:
+          attempts: 5
+          initialBackoff: 100ms
+          maxBackoff: 4s
+          backoffFactor: 2.0
+
+      eventService:
+        resolverStrategy: PreferOrg
+        balancer: Random
+        blockHeightLagThreshold: 10
+        reconnectBlockHeightLagThreshold: 10
+        peerMonitorPeriod: 1s
+`
+
+// configtxTemplate is the configtx.yaml of a game channel, rendered from
+// configtxData. The channel artifacts are built from its TFCChannel profile.
+const configtxTemplate = `Organizations:
+    - &Orderer
+        Name: Orderer
+        ID: {{.Network.OrdererMSPID}}
+        MSPDir: {{.Network.OrdererCryptoPath}}/msp
+        Policies:
+            Readers:
+                Type: Signature
+                Rule: "OR('{{.Network.OrdererMSPID}}.member')"
+            Writers:
+                Type: Signature
+                Rule: "OR('{{.Network.OrdererMSPID}}.member')"
+            Admins:
+                Type: Signature
+                Rule: "OR('{{.Network.OrdererMSPID}}.admin')"
+
+{{range .Orgs}}
+    - &{{.Name}}
+        Name: {{.Name}}
+        ID: {{.MSPID}}
+        MSPDir: {{.CryptoPath}}/msp
+        Policies:
+            Readers:
+                Type: Signature
+                Rule: "OR('{{.MSPID}}.admin', '{{.MSPID}}.peer', '{{.MSPID}}.client')"
+            Writers:
+                Type: Signature
+                Rule: "OR('{{.MSPID}}.admin', '{{.MSPID}}.client')"
+            Admins:
+                Type: Signature
+                Rule: "OR('{{.MSPID}}.admin')"
+        AnchorPeers:
+            - Host: {{(index .Peers 0).Host}}
+              Port: {{(index .Peers 0).Port}}
+{{end}}
+# see <https://hyperledger-fabric.readthedocs.io/en/release-1.3/capability_requirements.html>
+Capabilities:
+
+  Channel: &ChannelCapabilities
+        V1_3: true
+
+  Orderer: &OrdererCapabilities
+        V1_1: true
+
+  Application: &ApplicationCapabilities
+        V1_3: true
+        V1_2: false
+        V1_1: false
+
+Application: &ApplicationDefaults
+
+    Organizations:
+
+    Policies:
+        Readers:
+            Type: ImplicitMeta
+            Rule: "ANY Readers"
+        Writers:
+            Type: ImplicitMeta
+            Rule: "ANY Writers"
+        Admins:
+            Type: ImplicitMeta
+            Rule: "MAJORITY Admins"
+
+    Capabilities:
+        <<: *ApplicationCapabilities
+
+Orderer: &OrdererDefaults
+
+    OrdererType: kafka
+
+    Addresses:
+{{range .Network.Orderers}}
+        - {{.Host}}:{{.Port}}
+{{end}}
+
+    BatchTimeout: 2s
+
+    BatchSize:
+        MaxMessageCount: 10
+        AbsoluteMaxBytes: 99 MB
+        PreferredMaxBytes: 512 KB
+
+    Kafka:
+        Brokers:
+{{range .Network.KafkaBrokers}}
+            - {{.}}
+{{end}}
+
+    Organizations:
+
+    Policies:
+        Readers:
+            Type: ImplicitMeta
+            Rule: "ANY Readers"
+        Writers:
+            Type: ImplicitMeta
+            Rule: "ANY Writers"
+        Admins:
+            Type: ImplicitMeta
+            Rule: "MAJORITY Admins"
+        BlockValidation:
+            Type: ImplicitMeta
+            Rule: "ANY Writers"
+
+Channel: &ChannelDefaults
+
+    Policies:
+        Readers:
+            Type: ImplicitMeta
+            Rule: "ANY Readers"
+        Writers:
+            Type: ImplicitMeta
+            Rule: "ANY Writers"
+        Admins:
+            Type: ImplicitMeta
+            Rule: "MAJORITY Admins"
+
+    Capabilities:
+        <<: *ChannelCapabilities
+
+Profiles:
+
+    TFCOrdererGenesis:
+        <<: *ChannelDefaults
+        Orderer:
+            <<: *OrdererDefaults
+            Organizations:
+                - *Orderer
+            Capabilities:
+                <<: *OrdererCapabilities
+        Consortiums:
+            TFCConsortium:
+                Organizations:
+                    {{range .Orgs}}
+                        - *{{.Name}}
+                    {{end}}
+
+    TFCDevModeKafka:
+        <<: *ChannelDefaults
+        Capabilities:
+            <<: *ChannelCapabilities
+        Orderer:
+            <<: *OrdererDefaults
+            OrdererType: kafka
+            Kafka:
+                Brokers:
+{{range .Network.KafkaBrokers}}
+                - {{.}}
+{{end}}
+
+            Organizations:
+            - *Orderer
+            Capabilities:
+                <<: *OrdererCapabilities
+        Application:
+            <<: *ApplicationDefaults
+            Organizations:
+            - <<: *Orderer
+        Consortiums:
+            TFCConsortium:
+                Organizations:
+                    {{range .Orgs}}
+                    - *{{.Name}}
+                    {{end}}
+
+    TFCChannel:
+        Consortium: TFCConsortium
+        Application:
+            <<: *ApplicationDefaults
+            Organizations:
+                    {{range .Orgs}}
+                    - *{{.Name}}
+                    {{end}}
+
+            Capabilities:
+                <<: *ApplicationCapabilities
+`
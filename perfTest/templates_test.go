@@ -0,0 +1,95 @@
+package tfc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func clientConfigData(t *testing.T) pConfigData {
+	n := DefaultNetwork()
+	orgs, err := n.channelOrgs([]string{Player1, Player2})
+	require.NoError(t, err)
+	return pConfigData{orgs[0], orgs, n}
+}
+
+func TestBundledTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the templates do not depend on the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	cfgPath := filepath.Join(dir, "Player1Config.yaml")
+	require.NoError(t, executeTemplate("", cfgPath, "pConfig.yaml_template", clientConfigData(t)))
+	data, err := ioutil.ReadFile(cfgPath)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "organization: Player1")
+
+	require.Error(t, executeTemplate("", cfgPath, "generateChan.sh_template", clientConfigData(t)),
+		"expected an unknown template to be rejected")
+	require.Error(t, executeTemplate("", cfgPath, "pConfig.yaml_template", struct{}{}),
+		"expected the missing data to be rejected")
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfgPath := filepath.Join(dir, "Player1Config.yaml")
+	require.NoError(t, executeTemplate(dir, cfgPath, "pConfig.yaml_template", clientConfigData(t)),
+		"expected the bundled template without an override")
+
+	override := func(text string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pConfig.yaml_template"), []byte(text), 0644))
+	}
+	override(`
+client: {organization: {{.For.Name}}}
+organizations: {{"{"}}{{.For.Name}}: {peers: [p0]}}
+orderers: {o0: {url: "o0:7050"}}
+peers: {p0: {url: "p0:7051"}}
+`)
+	require.NoError(t, CheckTemplates(dir))
+	require.NoError(t, executeTemplate(dir, cfgPath, "pConfig.yaml_template", clientConfigData(t)))
+	data, err := ioutil.ReadFile(cfgPath)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "p0:7051", "expected the override to be rendered")
+
+	override("client: {organization: {{.For.Nickname}}}")
+	require.Error(t, executeTemplate(dir, cfgPath, "pConfig.yaml_template", clientConfigData(t)),
+		"expected the missing key to be rejected")
+
+	override("client: {organization: {{.For.Name")
+	require.Error(t, CheckTemplates(dir), "expected the unparsable template to be rejected")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "pConfig.yaml_template")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "generateChan.sh_template"), []byte(""), 0644))
+	require.Error(t, CheckTemplates(dir), "expected a template overriding nothing to be rejected")
+}
+
+func TestValidateClientConfig(t *testing.T) {
+	configs := map[string]string{
+		"not yaml":       "client: [",
+		"unknown org":    "client: {organization: Org1}\norganizations: {Org2: {}}\norderers: {o0: {url: o0}}",
+		"no orderers":    "client: {organization: Org1}\norganizations: {Org1: {}}",
+		"no orderer url": "client: {organization: Org1}\norganizations: {Org1: {}}\norderers: {o0: {}}",
+		"unknown peer":   "client: {organization: Org1}\norganizations: {Org1: {peers: [p0]}}\norderers: {o0: {url: o0}}",
+		"unknown channel peer": "client: {organization: Org1}\norganizations: {Org1: {}}\norderers: {o0: {url: o0}}\n" +
+			"channels: {_default: {peers: {p0: {}}}}",
+		"unknown CA": "client: {organization: Org1}\norganizations: {Org1: {certificateAuthorities: [ca]}}\n" +
+			"orderers: {o0: {url: o0}}",
+	}
+	for name, cfg := range configs {
+		require.Error(t, validateClientConfig([]byte(cfg)), "expected %s to be rejected", name)
+	}
+	require.NoError(t, validateClientConfig([]byte(
+		"client: {organization: Org1}\norganizations: {Org1: {peers: [p0]}}\norderers: {o0: {url: o0}}\npeers: {p0: {url: p0}}")))
+}
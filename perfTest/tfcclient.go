@@ -4,9 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strings"
+	"sync"
 
-	"github.com/go-kit/kit/metrics/prometheus"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
@@ -19,47 +18,88 @@ import (
 	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
 )
 
+// GameObserver forwards the completed transactions of a game to an alliance.
+// The game sends on TrxComplete, through Notify, and asks the observer to
+// terminate with Stop. The observer never closes the channels the game sends
+// on, it signals its termination by closing done instead.
 type GameObserver struct {
 	TrxComplete chan *tfcPb.TrxCompletedArgs
-	Shutdown    chan bool
-	Name        string
-	ObserverID  uint32
-	terminated  bool
+	// Shutdown is closed by Stop.
+	Shutdown chan struct{}
+	// Failure receives the error the observer terminated with, if any.
+	Failure    chan error
+	Name       string
+	ObserverID uint32
+
+	done      chan struct{}
+	stop      sync.Once
+	terminate sync.Once
+}
+
+func newGameObserver(name string, observerID uint32) *GameObserver {
+	return &GameObserver{
+		TrxComplete: make(chan *tfcPb.TrxCompletedArgs, 100),
+		Shutdown:    make(chan struct{}),
+		Failure:     make(chan error, 1),
+		Name:        name,
+		ObserverID:  observerID,
+		done:        make(chan struct{}),
+	}
+}
+
+// Notify forwards the completed transaction to the observer, unless the
+// observer has terminated.
+func (gObs *GameObserver) Notify(trx *tfcPb.TrxCompletedArgs) {
+	select {
+	case gObs.TrxComplete <- trx:
+	case <-gObs.done:
+	}
+}
+
+// Stop asks the observer to terminate. It may be called more than once.
+func (gObs *GameObserver) Stop() {
+	gObs.stop.Do(func() { close(gObs.Shutdown) })
 }
 
+// Terminate marks the observer as terminated. It is called by the observer.
 func (gObs *GameObserver) Terminate() {
-	close(gObs.Shutdown)
-	close(gObs.TrxComplete)
-	gObs.terminated = true
+	gObs.terminate.Do(func() { close(gObs.done) })
+}
+
+// Done is closed once the observer has terminated.
+func (gObs *GameObserver) Done() <-chan struct{} {
+	return gObs.done
 }
 
 // OrgContext provides SDK client context for a given org
 type TFCClient struct {
-	OrgID                string
-	CtxProvider          context.ClientProvider
-	SigningIdentity      msp.SigningIdentity
-	ResMgmt              *resmgmt.Client
-	PeerEndpoint         string
+	OrgID           string
+	GameName        string
+	CtxProvider     context.ClientProvider
+	SigningIdentity msp.SigningIdentity
+	ResMgmt         *resmgmt.Client
+	PeerEndpoint    string
+	// Peers are all the peers of the org. PeerEndpoint is the first of them.
+	Peers                []string
 	AnchorPeerConfigFile string
 	Endorser             string
 	SDK                  *fabsdk.FabricSDK
 	ChannelClient        *channel.Client
 	GameObservers        []*GameObserver
-	Metrics              *prometheus.Histogram
+	Metrics              *PlayerMetrics
+	FabricCfgPath        string
+	Ledger               Ledger
+	// Network is the topology the client reaches its peers, orderers and
+	// identities through.
+	Network Network
+	// endorsers picks the peers endorsing the transactions of the game.
+	endorsers *endorserSelector
+	// resources records what the game created on the network.
+	resources *gameResources
+	// cfg is the run config of the game.
+	cfg *RunConfig
 }
 
-const (
-	Player1         = "Player1"
-	Player2         = "Player2"
-	Player3         = "Player3"
-	Player4         = "Player4"
-	Player5         = "Player5"
-	AdminUser       = "Admin"
-	OrdererOrg      = "Orderer"
-	User            = "User1"
-	OrdererEndpoint = "orderer.tfc.com"
-)
-
 var (
 	scfixturesPath = path.Join(os.Getenv("SCFIXTURES"), "tfc")
 	gopath         = os.Getenv("GOPATH")
@@ -72,7 +112,12 @@ type ccDescriptor struct {
 	ccPackage *resource.CCPackage
 }
 
-func NewTFCClient(fabCfgPath, clientCfgPath, org, gameName string) (*TFCClient, error) {
+func NewTFCClient(fabCfgPath, clientCfgPath string, network Network, org, gameName string) (*TFCClient, error) {
+
+	netOrg, err := network.Org(org)
+	if err != nil {
+		return nil, err
+	}
 
 	configOpt := config.FromFile(clientCfgPath)
 	sdk, err := fabsdk.New(configOpt)
@@ -80,7 +125,7 @@ func NewTFCClient(fabCfgPath, clientCfgPath, org, gameName string) (*TFCClient,
 		return nil, fmt.Errorf("Failed to create new SDK: %s", err)
 	}
 
-	adminContext := sdk.Context(fabsdk.WithUser(AdminUser), fabsdk.WithOrg(org))
+	adminContext := sdk.Context(fabsdk.WithUser(network.Admin), fabsdk.WithOrg(org))
 	// Org resource management client
 	orgResMgmt, err := resmgmt.New(adminContext)
 	if err != nil {
@@ -90,7 +135,7 @@ func NewTFCClient(fabCfgPath, clientCfgPath, org, gameName string) (*TFCClient,
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create new resource management client: %s", err)
 	}
-	orgIdentity, err := client.GetSigningIdentity(AdminUser)
+	orgIdentity, err := client.GetSigningIdentity(network.Admin)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create new resource management client: %s", err)
 	}
@@ -102,13 +147,17 @@ func NewTFCClient(fabCfgPath, clientCfgPath, org, gameName string) (*TFCClient,
 		CtxProvider:          adminContext,
 		SigningIdentity:      orgIdentity,
 		ResMgmt:              orgResMgmt,
-		PeerEndpoint:         "peer0." + strings.ToLower(org) + ".tfc.com",
+		PeerEndpoint:         netOrg.Peers[0].Host,
+		Peers:                netOrg.peerHosts(),
 		AnchorPeerConfigFile: path.Join(fabCfgPath, org+"anchors.tx"),
-		Endorser:             org + "MSP.member",
+		Endorser:             netOrg.MSPID + ".member",
 		SDK:                  sdk,
 		ChannelClient:        nil,
 		GameObservers:        observers,
 		Metrics:              nil,
+		FabricCfgPath:        fabCfgPath,
+		Ledger:               fabricLedger{},
+		Network:              network,
 	}
 
 	return tfcClient, nil
@@ -14,12 +14,11 @@
 package tfc
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"flag"
 	"math/rand"
 	"strconv"
 	"testing"
-	"time"
 )
 
 /*
@@ -29,123 +28,77 @@ import (
 	3) Play a game
 */
 
-var playerPairs = [][]string{
-	{Player1, Player2, Player3},
-	{Player3, Player5, Player4},
-	{Player4, Player1, Player2},
-	{Player2, Player3, Player5},
-	{Player5, Player4, Player1},
-	{Player2, Player3, Player1},
-	{Player3, Player5, Player2},
-	{Player5, Player1, Player4},
-}
-
-func TestE2ETFC(t *testing.T) {
-	runName := "tfc"
-	rand.Seed(time.Now().Unix())
-	runName += strconv.Itoa(rand.Int() % 100)
-	promeShutdown := startProme()
-	defer promeShutdown()
-	players := []string{Player1, Player2, Player3}
-	respChan := make(chan (error), 10)
-	orgsIn := make(chan ([]string), 10)
-	orgsOut := make(chan ([]string), 10)
-	orgsIn <- players
-	execTFCGameAsync(runName, respChan, orgsIn, orgsOut)
-	<-orgsOut
-	<-respChan
-}
-
-func TestE2ETTT(t *testing.T) {
-	runName := "ttt"
-	rand.Seed(time.Now().Unix())
-	runName += strconv.Itoa(rand.Int() % 100)
-	promeShutdown := startProme()
-	defer promeShutdown()
-	players := []string{Player1, Player2, Player3}
-	respChan := make(chan (error), 10)
-	orgsIn := make(chan ([]string), 10)
-	orgsOut := make(chan ([]string), 10)
-	orgsIn <- players
-	execTTTGameAsync(runName, respChan, orgsIn, orgsOut)
-	<-orgsOut
-	<-respChan
-}
-
-func TestGoroutinesStatic(t *testing.T) {
-	testName := "rq"
-	rand.Seed(time.Now().Unix())
-	testName += strconv.Itoa(rand.Int() % 100)
-
-	promeShutdown := startProme()
-	defer promeShutdown()
+var (
+	e2e  = flag.Bool("e2e", false, "run the experiments against the running network, they are skipped otherwise")
+	seed = flag.Int64("seed", 0, "seed of the experiments, random if 0")
+)
 
-	testWithRoutines(t, 4, testName, execTFCGameAsync, playerPairs)
+// runConfig returns the config of the run, with the seed of -seed, and the
+// suffix of the run name drawn from the seed. The seed is logged, so the run
+// can be reproduced with -seed. The experiments need a running network, so
+// the test is skipped unless -e2e is set.
+func runConfig(t *testing.T) (*RunConfig, string) {
+	if !*e2e {
+		t.Skip("the experiments need a running network, enable them with -e2e")
+	}
+	cfg := DefaultRunConfig()
+	if *seed != 0 {
+		cfg.Seed = *seed
+	}
+	t.Logf("Running with seed %d", cfg.Seed)
+	return cfg, strconv.Itoa(rand.New(rand.NewSource(cfg.Seed)).Intn(100))
 }
 
-func TestGoroutinesIncremental(t *testing.T) {
-	testName := "ti"
-	rand.Seed(time.Now().Unix())
-	testName += strconv.Itoa(rand.Int() % 100)
-	promeShutdown := startProme()
-	defer promeShutdown()
-
-	// testWithRoutines(t, 1, "tfc"+testName, execTFCGameAsync, playerPairs)
-
-	for nOfRoutines := 2; nOfRoutines <= 16; nOfRoutines *= 2 {
-
-		nOfTFC := nOfRoutines/2 - 1
-		tfcDone := make(chan (bool), nOfTFC+1)
-		nOfTTT := nOfRoutines/2 + 1
-		tttDone := make(chan (bool), nOfTTT+1)
-
-		runName := fmt.Sprintf("%s%d", testName, nOfRoutines)
-		go testWithRoutinesAsync(t, nOfTFC, "tfc"+runName, execTFCGameAsync, playerPairs[:4], tfcDone)
-		go testWithRoutinesAsync(t, nOfTTT, "ttt"+runName, execTTTGameAsync, playerPairs[4:], tttDone)
-
-		log.Println("Waiting for TTT to be done....")
-		<-tttDone
-
-		log.Println("Waiting for TFC to be done....")
-		<-tfcDone
+func startMetricsServer(t *testing.T) *MetricsServer {
+	ms, err := NewMetricsServer(":9009", DefaultMetricsConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ms.Start()
+	if err != nil {
+		t.Fatal(err)
 	}
+	return ms
 }
 
-func testWithRoutinesAsync(t *testing.T, nOfRoutines int, runName string, asyncExec asyncExecutor, playerPairs [][]string, done chan (bool)) {
-	testWithRoutines(t, nOfRoutines, runName, asyncExec, playerPairs)
-	done <- true
+func TestE2ETFC(t *testing.T) {
+	cfg, suffix := runConfig(t)
+	ms := startMetricsServer(t)
+	defer ms.Shutdown()
+	requireRunSucceeded(t, Experiments["tfc"](context.Background(), cfg, "tfc"+suffix, ms.Metrics()))
 }
 
-func testWithRoutines(t *testing.T, nOfRoutines int, runName string, asyncExec asyncExecutor, playerPairs [][]string) {
+func TestE2ETTT(t *testing.T) {
+	cfg, suffix := runConfig(t)
+	ms := startMetricsServer(t)
+	defer ms.Shutdown()
+	requireRunSucceeded(t, Experiments["ttt"](context.Background(), cfg, "ttt"+suffix, ms.Metrics()))
+}
 
-	if nOfRoutines == 0 {
-		return
-	}
+var stages = flag.String("stages", "incremental",
+	"stages played by TestStages: static, incremental, spike, or the path of a stage plan")
 
-	errOutChan := make(chan (error))
-	defer close(errOutChan)
-	orgsIn := make(chan ([]string), len(playerPairs))
-	defer close(orgsIn)
-	orgsOut := make(chan ([]string), len(playerPairs)+1)
-	defer close(orgsOut)
+func TestStages(t *testing.T) {
+	cfg, suffix := runConfig(t)
 
-	for _, pp := range playerPairs {
-		orgsIn <- pp
+	experiment, ok := Experiments[*stages]
+	if !ok {
+		sp, err := LoadStagePlan(*stages, cfg.Network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		experiment = sp.Experiment()
 	}
 
-	log.Printf(" ############# \n\t Starting goRoutine run *%s* with %v routines, and player set %v. \n ##############",
-		runName, nOfRoutines, playerPairs)
+	ms := startMetricsServer(t)
+	defer ms.Shutdown()
 
-	for i := 0; i < nOfRoutines; i++ {
-		gameName := runName + strconv.Itoa(i+1)
-		go asyncExec(gameName, errOutChan, orgsIn, orgsOut)
-		orgsIn <- (<-orgsOut)
-	}
+	requireRunSucceeded(t, experiment(context.Background(), cfg, "st"+suffix, ms.Metrics()))
+}
 
-	for i := 0; i < nOfRoutines; i++ {
-		<-errOutChan
+// requireRunSucceeded fails the test if any game of the run failed.
+func requireRunSucceeded(t *testing.T, err error) {
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
 	}
-
-	log.Printf(" ############# \n\t Finished goRoutine run *%s* . \n ##############",
-		runName)
 }
@@ -0,0 +1,319 @@
+package tfc
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	tfcCC "github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+)
+
+const (
+	tfcCCPath      = "github.com/stefanprisca/strategy-code/cmd/tfc"
+	allianceCCPath = "github.com/stefanprisca/strategy-code/cmd/alliance"
+)
+
+func init() {
+	RegisterSimContract(tfcCCPath, newTFCSim)
+	RegisterSimContract(allianceCCPath, newAllianceSim)
+}
+
+// tfcTurns describes, for each state of a running game, the player whose turn
+// it is and the state a NEXT transaction moves the game to.
+var tfcTurns = map[tfcPb.GameState]struct {
+	player tfcPb.Player
+	next   tfcPb.GameState
+}{
+	tfcPb.GameState_RROLL:  {tfcPb.Player_RED, tfcPb.GameState_RTRADE},
+	tfcPb.GameState_RTRADE: {tfcPb.Player_RED, tfcPb.GameState_RDEV},
+	tfcPb.GameState_RDEV:   {tfcPb.Player_RED, tfcPb.GameState_BROLL},
+	tfcPb.GameState_BROLL:  {tfcPb.Player_BLUE, tfcPb.GameState_BTRADE},
+	tfcPb.GameState_BTRADE: {tfcPb.Player_BLUE, tfcPb.GameState_BDEV},
+	tfcPb.GameState_BDEV:   {tfcPb.Player_BLUE, tfcPb.GameState_GROLL},
+	tfcPb.GameState_GROLL:  {tfcPb.Player_GREEN, tfcPb.GameState_GTRADE},
+	tfcPb.GameState_GTRADE: {tfcPb.Player_GREEN, tfcPb.GameState_GDEV},
+	tfcPb.GameState_GDEV:   {tfcPb.Player_GREEN, tfcPb.GameState_RROLL},
+}
+
+var tfcWonStates = map[tfcPb.Player]tfcPb.GameState{
+	tfcPb.Player_RED:   tfcPb.GameState_RWON,
+	tfcPb.Player_BLUE:  tfcPb.GameState_BWON,
+	tfcPb.Player_GREEN: tfcPb.GameState_GWON,
+}
+
+// tfcSim simulates the TFC game chaincode. It follows the same state machine
+// as the chaincode: players join until all three colors are taken, then take
+// turns to roll, trade and develop. An org may join with several colors.
+// Trades are only accepted from the player whose turn it is, and may not
+// leave any player with negative resources. Development transactions are not
+// simulated and are rejected.
+type tfcSim struct {
+	gameData *tfcPb.GameData
+}
+
+func newTFCSim() SimContract {
+	return &tfcSim{}
+}
+
+func (ts *tfcSim) Init(args [][]byte) error {
+	gameBoard, err := tfcCC.NewGameBoard()
+	if err != nil {
+		return fmt.Errorf("could not create game board: %s", err)
+	}
+
+	ts.gameData = &tfcPb.GameData{
+		Board: gameBoard,
+		State: tfcPb.GameState_JOINING,
+	}
+	return nil
+}
+
+func (ts *tfcSim) Invoke(creator string, fcn string, args [][]byte) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing transaction arguments")
+	}
+
+	trxArgs := &tfcPb.GameContractTrxArgs{}
+	err := proto.Unmarshal(args[0], trxArgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal arguments proto message <%v>: %s", args[0], err)
+	}
+
+	// Work on a copy, so rejected transactions leave the game untouched
+	gameData := proto.Clone(ts.gameData).(*tfcPb.GameData)
+	if gameData.Profiles == nil {
+		gameData.Profiles = make(map[int32]*tfcPb.PlayerProfile)
+		gameData.IdentityMap = make(map[int32][]byte)
+	}
+
+	switch trxArgs.Type {
+	case tfcPb.GameTrxType_JOIN:
+		err = simJoin(gameData, creator, trxArgs.JoinTrxPayload)
+	case tfcPb.GameTrxType_ROLL:
+		err = simRoll(gameData)
+	case tfcPb.GameTrxType_NEXT:
+		err = simNext(gameData)
+	case tfcPb.GameTrxType_TRADE:
+		err = simTrade(gameData, creator, trxArgs.TradeTrxPayload)
+	default:
+		err = fmt.Errorf("transaction type %v is not simulated", trxArgs.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ts.gameData = gameData
+	return proto.Marshal(gameData)
+}
+
+func simJoin(gameData *tfcPb.GameData, creator string, payload *tfcPb.JoinTrxPayload) error {
+	if payload == nil {
+		return fmt.Errorf("missing join payload")
+	}
+	if gameData.State != tfcPb.GameState_JOINING {
+		return fmt.Errorf("unexpected game state. expected %v, got %v",
+			tfcPb.GameState_JOINING, gameData.State)
+	}
+
+	playerID := tfcCC.GetPlayerId(payload.Player)
+	if _, ok := gameData.Profiles[playerID]; ok {
+		return fmt.Errorf("player <%v> already taken", payload.Player)
+	}
+
+	gameData.IdentityMap[playerID] = []byte(creator)
+	gameData.Profiles[playerID] = tfcCC.InitPlayerProfile()
+
+	if len(gameData.Profiles) == len(tfcWonStates) {
+		gameData.State = tfcPb.GameState_RROLL
+	}
+	return nil
+}
+
+func simRoll(gameData *tfcPb.GameData) error {
+	switch gameData.State {
+	case tfcPb.GameState_RROLL, tfcPb.GameState_BROLL, tfcPb.GameState_GROLL:
+		gameData.State = tfcTurns[gameData.State].next
+		return nil
+	}
+	return fmt.Errorf("cannot roll in state %v", gameData.State)
+}
+
+func simNext(gameData *tfcPb.GameData) error {
+	turn, ok := tfcTurns[gameData.State]
+	switch gameData.State {
+	case tfcPb.GameState_BROLL, tfcPb.GameState_GROLL:
+		// the chaincode only lets red skip its roll
+		ok = false
+	}
+	if !ok {
+		return fmt.Errorf("cannot move to the next state from %v", gameData.State)
+	}
+
+	switch gameData.State {
+	case tfcPb.GameState_RDEV, tfcPb.GameState_BDEV, tfcPb.GameState_GDEV:
+		profile := gameData.Profiles[tfcCC.GetPlayerId(turn.player)]
+		if profile.WinningPoints > 10 {
+			gameData.State = tfcWonStates[turn.player]
+			return nil
+		}
+	}
+
+	gameData.State = turn.next
+	return nil
+}
+
+func simTrade(gameData *tfcPb.GameData, creator string, payload *tfcPb.TradeTrxPayload) error {
+	if payload == nil {
+		return fmt.Errorf("missing trade payload")
+	}
+
+	src, err := getSimCreator(gameData, creator)
+	if err != nil || src != payload.Source {
+		return fmt.Errorf("invalid trx creator, or creator not identified: expected %v, got %s",
+			payload.Source, creator)
+	}
+
+	if !isTradeState(gameData.State) || tfcTurns[gameData.State].player != src {
+		return fmt.Errorf("player %v cannot trade in state %v", src, gameData.State)
+	}
+
+	destProfile, ok := gameData.Profiles[tfcCC.GetPlayerId(payload.Dest)]
+	if !ok {
+		return fmt.Errorf("player %v has not joined the game", payload.Dest)
+	}
+	srcProfile := gameData.Profiles[tfcCC.GetPlayerId(src)]
+
+	resID := tfcCC.GetResourceId(payload.Resource)
+	srcProfile.Resources[resID] -= payload.Amount
+	destProfile.Resources[resID] += payload.Amount
+
+	for _, p := range []tfcPb.Player{src, payload.Dest} {
+		if available := gameData.Profiles[tfcCC.GetPlayerId(p)].Resources[resID]; available < 0 {
+			return fmt.Errorf("player %v does not have required %v resources: available: %v",
+				p, payload.Resource, available)
+		}
+	}
+	return nil
+}
+
+func isTradeState(state tfcPb.GameState) bool {
+	switch state {
+	case tfcPb.GameState_RTRADE, tfcPb.GameState_BTRADE, tfcPb.GameState_GTRADE:
+		return true
+	}
+	return false
+}
+
+// getSimCreator returns the color of the creator org. The chaincode picks any
+// of the colors of an org which joined with several, so their transactions
+// are rejected rather than accepted by chance.
+func getSimCreator(gameData *tfcPb.GameData, creator string) (tfcPb.Player, error) {
+	colors := []tfcPb.Player{}
+	for pID, sign := range gameData.IdentityMap {
+		if string(sign) == creator {
+			colors = append(colors, tfcPb.Player(pID))
+		}
+	}
+	switch len(colors) {
+	case 0:
+		return tfcPb.Player(-1), fmt.Errorf("unknown creator %s", creator)
+	case 1:
+		return colors[0], nil
+	}
+	return tfcPb.Player(-1), fmt.Errorf("creator %s plays several colors %v", creator, colors)
+}
+
+// allianceSim simulates the alliance chaincode. Alliances complete once all
+// their terms were observed as completed game transactions, and fail if their
+// lifespan runs out before that.
+type allianceSim struct {
+	alliances map[uint32]*tfcPb.AllianceData
+}
+
+func newAllianceSim() SimContract {
+	return &allianceSim{}
+}
+
+func (as *allianceSim) Init(args [][]byte) error {
+	as.alliances = make(map[uint32]*tfcPb.AllianceData)
+	return nil
+}
+
+func (as *allianceSim) Invoke(creator string, fcn string, args [][]byte) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing transaction arguments")
+	}
+
+	trxArgs := &tfcPb.AllianceTrxArgs{}
+	err := proto.Unmarshal(args[0], trxArgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal arguments proto message <%v>: %s", args[0], err)
+	}
+
+	var allianceData *tfcPb.AllianceData
+	switch trxArgs.Type {
+	case tfcPb.AllianceTrxType_INIT:
+		allianceData, err = as.initAlliance(trxArgs.InitPayload)
+	case tfcPb.AllianceTrxType_INVOKE:
+		allianceData, err = as.observe(trxArgs.InvokePayload)
+	default:
+		err = fmt.Errorf("unknown alliance transaction type %v", trxArgs.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(allianceData)
+}
+
+func (as *allianceSim) initAlliance(payload *tfcPb.AllianceData) (*tfcPb.AllianceData, error) {
+	if payload == nil {
+		return nil, fmt.Errorf("missing alliance init payload")
+	}
+	if _, ok := as.alliances[payload.ContractID]; ok {
+		return nil, fmt.Errorf("alliance %d already exists", payload.ContractID)
+	}
+
+	allianceData := proto.Clone(payload).(*tfcPb.AllianceData)
+	allianceData.State = tfcPb.AllianceState_ACTIVE
+	// the lifespan is reduced by one after the first next
+	allianceData.Lifespan++
+
+	as.alliances[allianceData.ContractID] = allianceData
+	return allianceData, nil
+}
+
+func (as *allianceSim) observe(payload *tfcPb.TrxCompletedArgs) (*tfcPb.AllianceData, error) {
+	if payload == nil || payload.CompletedTrxArgs == nil {
+		return nil, fmt.Errorf("missing alliance invoke payload")
+	}
+
+	allianceData, ok := as.alliances[payload.ObserverID]
+	if !ok {
+		return nil, fmt.Errorf("alliance %d does not exist", payload.ObserverID)
+	}
+
+	terms := []*tfcPb.GameContractTrxArgs{}
+	for _, term := range allianceData.Terms {
+		if !proto.Equal(term, payload.CompletedTrxArgs) {
+			terms = append(terms, term)
+		}
+	}
+	allianceData.Terms = terms
+
+	if payload.State == allianceData.StartGameState &&
+		payload.CompletedTrxArgs.Type == tfcPb.GameTrxType_NEXT {
+		allianceData.Lifespan--
+	}
+
+	switch {
+	case len(allianceData.Terms) == 0:
+		allianceData.State = tfcPb.AllianceState_COMPLETED
+	case allianceData.Lifespan == 0:
+		allianceData.State = tfcPb.AllianceState_FAILED
+	default:
+		allianceData.State = tfcPb.AllianceState_ACTIVE
+	}
+
+	return allianceData, nil
+}
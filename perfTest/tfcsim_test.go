@@ -0,0 +1,301 @@
+package tfc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	tfcCC "github.com/stefanprisca/strategy-code/tfc"
+	tfcPb "github.com/stefanprisca/strategy-protobufs/tfc"
+	"github.com/stretchr/testify/require"
+)
+
+func tfcStep(p *TFCClient, args *tfcPb.GameContractTrxArgs) scriptStep {
+	return scriptStep{message: args, player: p}
+}
+
+func TestTFCSimScript(t *testing.T) {
+	p1, p2, p3 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}, &TFCClient{OrgID: Player3}
+
+	script, _ := scriptTFC1(p1, p2, p3)
+	payloads, err := checkScript(script, tfcCCPath)
+	require.NoError(t, err, "expected script to be legal")
+
+	gameData := &tfcPb.GameData{}
+	err = proto.Unmarshal(payloads[len(payloads)-1], gameData)
+	require.NoError(t, err, "could not unmarshal game data")
+
+	require.Equal(t, tfcPb.GameState_RROLL, gameData.State)
+	require.Len(t, gameData.Profiles, 3)
+	for _, profile := range gameData.Profiles {
+		require.Equal(t, tfcCC.InitPlayerProfile().Resources, profile.Resources,
+			"expected all trades to cancel out")
+	}
+}
+
+func TestTFCSimRejectsIllegalMoves(t *testing.T) {
+	p1, p2, p3 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}, &TFCClient{OrgID: Player3}
+	R, G, B := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+
+	join := func(p *TFCClient, c tfcPb.Player) scriptStep {
+		return tfcStep(p, tfcCC.NewArgsBuilder().WithJoinArgs(c).Args())
+	}
+	roll := func(p *TFCClient) scriptStep {
+		return tfcStep(p, tfcCC.NewArgsBuilder().WithRollArgs().Args())
+	}
+	next := func(p *TFCClient) scriptStep {
+		return tfcStep(p, tfcCC.NewArgsBuilder().WithNextArgs().Args())
+	}
+	trade := func(p *TFCClient, src, dest tfcPb.Player, a int32) scriptStep {
+		return tfcStep(p, tfcCC.NewArgsBuilder().WithTradeArgs(src, dest, tfcPb.Resource_HILL, a).Args())
+	}
+	joined := []scriptStep{join(p1, R), join(p2, G), join(p3, B)}
+	with := func(steps ...scriptStep) []scriptStep {
+		return append(append([]scriptStep{}, joined...), steps...)
+	}
+
+	scripts := map[string][]scriptStep{
+		"color taken":         {join(p1, R), join(p2, R)},
+		"roll while joining":  {join(p1, R), roll(p1)},
+		"next while joining":  {join(p1, R), next(p1)},
+		"join after start":    with(join(p1, R)),
+		"trade before roll":   with(trade(p1, R, G, 1)),
+		"roll twice":          with(roll(p1), roll(p1)),
+		"trade out of turn":   with(roll(p2), trade(p2, G, R, 1)),
+		"trade for others":    with(roll(p1), trade(p2, R, G, 1)),
+		"trade in dev":        with(roll(p1), next(p1), trade(p1, R, G, 1)),
+		"not enough source":   with(roll(p1), trade(p1, R, G, 6)),
+		"not enough dest":     with(roll(p1), trade(p1, R, G, -6)),
+		"develop":             with(roll(p1), next(p1), tfcStep(p1, tfcCC.NewArgsBuilder().WithBuildRoadArgs(R, 1).Args())),
+		"next in blue roll":   with(roll(p1), next(p1), next(p1), next(p2)),
+		"next in green roll":  with(roll(p1), next(p1), next(p1), roll(p2), next(p2), next(p2), next(p3)),
+		"trade of two colors": {join(p1, R), join(p1, G), join(p2, B), roll(p1), trade(p1, R, G, 1)},
+	}
+
+	for name, script := range scripts {
+		payloads, err := checkScript(script, tfcCCPath)
+		require.Error(t, err, "expected %s to be rejected", name)
+		require.Len(t, payloads, len(script)-1,
+			"expected only the last step of %s to be rejected", name)
+	}
+}
+
+func TestTFCSimFollowsChaincodeTransitions(t *testing.T) {
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+	R, G, B := tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Player_BLUE
+
+	script := []scriptStep{
+		// an org may join with a second color
+		tfcStep(p1, tfcCC.NewArgsBuilder().WithJoinArgs(R).Args()),
+		tfcStep(p1, tfcCC.NewArgsBuilder().WithJoinArgs(G).Args()),
+		tfcStep(p2, tfcCC.NewArgsBuilder().WithJoinArgs(B).Args()),
+		// red may skip its roll
+		tfcStep(p1, tfcCC.NewArgsBuilder().WithNextArgs().Args()),
+	}
+	payloads, err := checkScript(script, tfcCCPath)
+	require.NoError(t, err, "expected script to be legal")
+
+	gameData := &tfcPb.GameData{}
+	require.NoError(t, proto.Unmarshal(payloads[2], gameData))
+	require.Equal(t, tfcPb.GameState_RROLL, gameData.State)
+	require.Equal(t, []byte(Player1), gameData.IdentityMap[tfcCC.GetPlayerId(G)])
+
+	require.NoError(t, proto.Unmarshal(payloads[3], gameData))
+	require.Equal(t, tfcPb.GameState_RTRADE, gameData.State)
+}
+
+func TestTFCSimRejectedTradeKeepsState(t *testing.T) {
+	contract := newTFCSim()
+	require.NoError(t, contract.Init([][]byte{}))
+
+	invoke := func(creator string, args *tfcPb.GameContractTrxArgs) (*tfcPb.GameData, error) {
+		protoArgs, err := proto.Marshal(args)
+		require.NoError(t, err)
+		payload, err := contract.Invoke(creator, "publish", [][]byte{protoArgs})
+		if err != nil {
+			return nil, err
+		}
+		gameData := &tfcPb.GameData{}
+		require.NoError(t, proto.Unmarshal(payload, gameData))
+		return gameData, nil
+	}
+
+	for org, c := range map[string]tfcPb.Player{
+		Player1: tfcPb.Player_RED, Player2: tfcPb.Player_GREEN, Player3: tfcPb.Player_BLUE} {
+		_, err := invoke(org, tfcCC.NewArgsBuilder().WithJoinArgs(c).Args())
+		require.NoError(t, err)
+	}
+	_, err := invoke(Player1, tfcCC.NewArgsBuilder().WithRollArgs().Args())
+	require.NoError(t, err)
+
+	_, err = invoke(Player1, tfcCC.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_HILL, 6).Args())
+	require.Error(t, err, "expected trade to be rejected")
+
+	gameData, err := invoke(Player1, tfcCC.NewArgsBuilder().
+		WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_GREEN, tfcPb.Resource_HILL, 5).Args())
+	require.NoError(t, err, "expected rejected trade to leave the resources untouched")
+
+	resID := tfcCC.GetResourceId(tfcPb.Resource_HILL)
+	require.Equal(t, int32(0), gameData.Profiles[tfcCC.GetPlayerId(tfcPb.Player_RED)].Resources[resID])
+	require.Equal(t, int32(10), gameData.Profiles[tfcCC.GetPlayerId(tfcPb.Player_GREEN)].Resources[resID])
+	require.Equal(t, tfcPb.GameState_RTRADE, gameData.State)
+}
+
+func TestAllianceSim(t *testing.T) {
+	contract := newAllianceSim()
+	require.NoError(t, contract.Init([][]byte{}))
+
+	terms := []*tfcPb.GameContractTrxArgs{
+		tfcCC.NewArgsBuilder().WithTradeArgs(tfcPb.Player_RED, tfcPb.Player_BLUE, tfcPb.Resource_HILL, 2).Args(),
+		tfcCC.NewArgsBuilder().WithTradeArgs(tfcPb.Player_BLUE, tfcPb.Player_RED, tfcPb.Resource_HILL, 2).Args(),
+	}
+
+	invoke := func(args *tfcPb.AllianceTrxArgs) *tfcPb.AllianceData {
+		protoArgs, err := proto.Marshal(args)
+		require.NoError(t, err)
+		payload, err := contract.Invoke(Player1, "publish", [][]byte{protoArgs})
+		require.NoError(t, err)
+		allianceData := &tfcPb.AllianceData{}
+		require.NoError(t, proto.Unmarshal(payload, allianceData))
+		return allianceData
+	}
+	observe := func(trx *tfcPb.GameContractTrxArgs) *tfcPb.AllianceData {
+		return invoke(&tfcPb.AllianceTrxArgs{
+			Type:          tfcPb.AllianceTrxType_INVOKE,
+			InvokePayload: &tfcPb.TrxCompletedArgs{CompletedTrxArgs: trx, ObserverID: 101},
+		})
+	}
+
+	ad := invoke(&tfcPb.AllianceTrxArgs{
+		Type: tfcPb.AllianceTrxType_INIT,
+		InitPayload: &tfcPb.AllianceData{
+			Lifespan:       3,
+			StartGameState: tfcPb.GameState_RTRADE,
+			Terms:          terms,
+			ContractID:     101,
+		},
+	})
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, ad.State)
+	require.Equal(t, int32(4), ad.Lifespan)
+
+	ad = observe(tfcCC.NewArgsBuilder().WithRollArgs().Args())
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, ad.State)
+	require.Len(t, ad.Terms, 2)
+
+	ad = observe(terms[1])
+	require.Equal(t, tfcPb.AllianceState_ACTIVE, ad.State)
+	require.Len(t, ad.Terms, 1)
+
+	ad = observe(terms[0])
+	require.Equal(t, tfcPb.AllianceState_COMPLETED, ad.State)
+}
+
+func TestTFCSimMakeAlliance(t *testing.T) {
+	cfg := simRunConfig("tfc")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "tfc", Path: tfcCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "simtfc", []string{Player1, Player2, Player3}, ccReq, newTestMetrics(t))
+	require.NoError(t, err, "could not bootstrap the game")
+	defer closePlayers(players)
+
+	_, alGenerator := scriptTFC1(players[0], players[1], players[2])
+	allianceErrOut := make(chan (error), 1)
+	alGenerator(context.Background(), cfg.gameRand("simtfc"), 0, "simtfc", allianceErrOut)
+	require.NoError(t, <-allianceErrOut)
+}
+
+// failingAllianceLedger fails the alliance transactions after the first one,
+// which creates the alliance.
+type failingAllianceLedger struct {
+	Ledger
+	lock        sync.Mutex
+	nOfAlliance int
+}
+
+func (fl *failingAllianceLedger) Execute(ctx context.Context, player *TFCClient, req channel.Request) (channel.Response, TrxPhases, error) {
+	if req.ChaincodeID != "tfc" {
+		fl.lock.Lock()
+		fl.nOfAlliance++
+		n := fl.nOfAlliance
+		fl.lock.Unlock()
+		if n > 1 {
+			return channel.Response{}, TrxPhases{}, fmt.Errorf("alliance %s is down", req.ChaincodeID)
+		}
+	}
+	return fl.Ledger.Execute(ctx, player, req)
+}
+
+// playWithTerminatedObserver creates an alliance observed with the context,
+// plays the first round of the script, and the next one once the observer
+// terminated. The players don't think.
+func playWithTerminatedObserver(t *testing.T, ctx context.Context, cfg *RunConfig, gameName string, players []*TFCClient) {
+	cfg.ThinkTimes = ThinkTimes{Default: ThinkTime{Kind: "constant"}}
+
+	script, alGenerator := scriptTFC1(players[0], players[1], players[2])
+	allianceErrOut := make(chan (error), 1)
+	alGenerator(ctx, cfg.gameRand(gameName), 0, gameName, allianceErrOut)
+	require.NoError(t, <-allianceErrOut)
+
+	var observer *GameObserver
+	for _, p := range players {
+		if len(p.GameObservers) > 0 {
+			observer = p.GameObservers[0]
+		}
+	}
+	require.NotNil(t, observer, "expected the alliance to be observed")
+
+	think := newThinkTimer(cfg.ThinkTimes, cfg.gameRand(gameName))
+	_, err := runGameScript(context.Background(), cfg, think, script[:20], "tfc", players)
+	require.NoError(t, err)
+
+	select {
+	case <-observer.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the observer to terminate")
+	}
+
+	// the game goes on without the observer
+	_, err = runGameScript(context.Background(), cfg, think, script[20:37], "tfc", players)
+	require.NoError(t, err)
+}
+
+func TestAllianceObserverFailsMidGame(t *testing.T) {
+	cfg := simRunConfig("tfc")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "tfc", Path: tfcCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "simtfcfail", []string{Player1, Player2, Player3}, ccReq, newTestMetrics(t))
+	require.NoError(t, err, "could not bootstrap the game")
+	ledger := &failingAllianceLedger{Ledger: players[0].Ledger}
+	for _, p := range players {
+		p.Ledger = ledger
+	}
+
+	playWithTerminatedObserver(t, context.Background(), cfg, "simtfcfail", players)
+	closePlayers(players)
+
+	err = observerFailure(players)
+	require.Error(t, err, "expected the observer failure to fail the game")
+	require.Equal(t, ObserverPhase, err.(*GameError).Phase)
+}
+
+func TestAllianceObserverTimesOutMidGame(t *testing.T) {
+	cfg := simRunConfig("tfc")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "tfc", Path: tfcCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "simtfctimeout", []string{Player1, Player2, Player3}, ccReq, newTestMetrics(t))
+	require.NoError(t, err, "could not bootstrap the game")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	playWithTerminatedObserver(t, ctx, cfg, "simtfctimeout", players)
+	closePlayers(players)
+}
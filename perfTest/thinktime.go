@@ -0,0 +1,191 @@
+package tfc
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// ThinkTime describes the distribution of the time a player waits before
+// each of its script steps. Kind is one of:
+//   - constant: always Value, zero for bots hammering the network
+//   - uniform: between Min and Max
+//   - exponential: with the mean Mean
+//   - normal: with the mean Mean and standard deviation StdDev, cut off at 0
+//   - replay: the think times of the run log Trace, in order
+//
+// The think times of a trace are the gaps between consecutive invocations of
+// each of its games.
+type ThinkTime struct {
+	Kind   string        `yaml:"kind"`
+	Value  time.Duration `yaml:"value"`
+	Min    time.Duration `yaml:"min"`
+	Max    time.Duration `yaml:"max"`
+	Mean   time.Duration `yaml:"mean"`
+	StdDev time.Duration `yaml:"stdDev"`
+	Trace  string        `yaml:"trace"`
+}
+
+// thinkTimeSampler draws think times. Samplers are not safe for concurrent
+// use.
+type thinkTimeSampler func(rnd *rand.Rand) time.Duration
+
+// newSampler checks the distribution, and returns a sampler drawing from it.
+func (tt ThinkTime) newSampler() (thinkTimeSampler, error) {
+	switch tt.Kind {
+	case "constant":
+		if tt.Value < 0 {
+			return nil, fmt.Errorf("constant think time can not be negative")
+		}
+		return func(*rand.Rand) time.Duration { return tt.Value }, nil
+	case "uniform":
+		if tt.Min < 0 || tt.Max < tt.Min {
+			return nil, fmt.Errorf("uniform think time needs 0 <= min <= max, got %s and %s", tt.Min, tt.Max)
+		}
+		return func(rnd *rand.Rand) time.Duration {
+			if tt.Max == tt.Min {
+				return tt.Min
+			}
+			return tt.Min + time.Duration(rnd.Int63n(int64(tt.Max-tt.Min)))
+		}, nil
+	case "exponential":
+		if tt.Mean <= 0 {
+			return nil, fmt.Errorf("exponential think time needs a positive mean")
+		}
+		return func(rnd *rand.Rand) time.Duration {
+			return time.Duration(rnd.ExpFloat64() * float64(tt.Mean))
+		}, nil
+	case "normal":
+		if tt.Mean < 0 || tt.StdDev < 0 {
+			return nil, fmt.Errorf("normal think time can not have a negative mean or standard deviation")
+		}
+		return func(rnd *rand.Rand) time.Duration {
+			d := time.Duration(float64(tt.Mean) + rnd.NormFloat64()*float64(tt.StdDev))
+			if d < 0 {
+				return 0
+			}
+			return d
+		}, nil
+	case "replay":
+		gaps, err := traceThinkTimes(tt.Trace)
+		if err != nil {
+			return nil, err
+		}
+		next := 0
+		return func(*rand.Rand) time.Duration {
+			d := gaps[next%len(gaps)]
+			next++
+			return d
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown think time distribution %q", tt.Kind)
+}
+
+// traceThinkTimes reads the gaps between the invocations of every game of the
+// run log, game after game.
+func traceThinkTimes(tracePath string) ([]time.Duration, error) {
+	if tracePath == "" {
+		return nil, fmt.Errorf("replayed think time needs a trace")
+	}
+	records, err := ReadRunLog(tracePath)
+	if err != nil {
+		return nil, err
+	}
+
+	games := []string{}
+	invokes := map[string][]RunRecord{}
+	for _, rec := range records {
+		if rec.Op != "" && rec.Op != InvokeOp {
+			continue
+		}
+		if _, ok := invokes[rec.Game]; !ok {
+			games = append(games, rec.Game)
+		}
+		invokes[rec.Game] = append(invokes[rec.Game], rec)
+	}
+
+	gaps := []time.Duration{}
+	for _, game := range games {
+		recs := invokes[game]
+		sort.SliceStable(recs, func(i, j int) bool { return recs[i].Time.Before(recs[j].Time) })
+		for i := 1; i < len(recs); i++ {
+			prevEnd := recs[i-1].Time.Add(time.Duration(recs[i-1].Latency * float64(time.Second)))
+			gap := recs[i].Time.Sub(prevEnd)
+			if gap < 0 {
+				gap = 0
+			}
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return nil, fmt.Errorf("trace %s has no consecutive invocations to replay", tracePath)
+	}
+	return gaps, nil
+}
+
+// ThinkTimes configures the think times of all players.
+type ThinkTimes struct {
+	Default ThinkTime `yaml:"default"`
+	// Players overrides the default for the players of the given orgs.
+	Players map[string]ThinkTime `yaml:"players"`
+}
+
+// DefaultThinkTimes waits between 100ms and 600ms before every step.
+func DefaultThinkTimes() ThinkTimes {
+	return ThinkTimes{
+		Default: ThinkTime{Kind: "uniform", Min: 100 * time.Millisecond, Max: 600 * time.Millisecond},
+	}
+}
+
+// Validate checks all the distributions.
+func (tts ThinkTimes) Validate() error {
+	if _, err := tts.Default.newSampler(); err != nil {
+		return err
+	}
+	for org, tt := range tts.Players {
+		if _, err := tt.newSampler(); err != nil {
+			return fmt.Errorf("think time of %s: %s", org, err)
+		}
+	}
+	return nil
+}
+
+func (tts ThinkTimes) forOrg(org string) ThinkTime {
+	if tt, ok := tts.Players[org]; ok {
+		return tt
+	}
+	return tts.Default
+}
+
+// thinkTimer draws the think times of the players of a game, each from its
+// own sampler.
+type thinkTimer struct {
+	thinkTimes ThinkTimes
+	rnd        *rand.Rand
+	samplers   map[*TFCClient]thinkTimeSampler
+}
+
+func newThinkTimer(thinkTimes ThinkTimes, rnd *rand.Rand) *thinkTimer {
+	return &thinkTimer{thinkTimes: thinkTimes, rnd: rnd, samplers: make(map[*TFCClient]thinkTimeSampler)}
+}
+
+// next draws the think time before the step, from the distribution of the
+// step if it has one, or else from the think times of its player.
+func (tt *thinkTimer) next(step scriptStep) (time.Duration, error) {
+	sampler, ok := tt.samplers[step.player]
+	if !ok {
+		dist := tt.thinkTimes.forOrg(step.player.OrgID)
+		if step.thinkTime != nil {
+			dist = *step.thinkTime
+		}
+
+		var err error
+		sampler, err = dist.newSampler()
+		if err != nil {
+			return 0, err
+		}
+		tt.samplers[step.player] = sampler
+	}
+	return sampler(tt.rnd), nil
+}
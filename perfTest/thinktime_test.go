@@ -0,0 +1,112 @@
+package tfc
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sampleThinkTimes(t *testing.T, tt ThinkTime, n int) []time.Duration {
+	sampler, err := tt.newSampler()
+	require.NoError(t, err, "could not create sampler for %v", tt)
+
+	rnd := rand.New(rand.NewSource(42))
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		samples[i] = sampler(rnd)
+	}
+	return samples
+}
+
+func meanDuration(samples []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / time.Duration(len(samples))
+}
+
+func TestThinkTimeDistributions(t *testing.T) {
+	for _, s := range sampleThinkTimes(t, ThinkTime{Kind: "constant"}, 10) {
+		require.Equal(t, time.Duration(0), s)
+	}
+
+	uniform := sampleThinkTimes(t, ThinkTime{Kind: "uniform", Min: time.Second, Max: 2 * time.Second}, 1000)
+	for _, s := range uniform {
+		require.True(t, s >= time.Second && s < 2*time.Second, "%s is out of bounds", s)
+	}
+
+	exponential := sampleThinkTimes(t, ThinkTime{Kind: "exponential", Mean: time.Second}, 10000)
+	require.InDelta(t, float64(time.Second), float64(meanDuration(exponential)), float64(50*time.Millisecond))
+
+	normal := sampleThinkTimes(t, ThinkTime{Kind: "normal", Mean: 100 * time.Millisecond, StdDev: time.Second}, 1000)
+	for _, s := range normal {
+		require.True(t, s >= 0, "expected normal think times to be cut off at 0")
+	}
+}
+
+func TestThinkTimeReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "thinktime")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tracePath := filepath.Join(dir, "trace.jsonl")
+	rl, err := NewRunLog(tracePath)
+	require.NoError(t, err)
+
+	start := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	rl.Record(RunRecord{Time: start, Game: "g1", Op: BootstrapOp, Latency: 10})
+	rl.Record(RunRecord{Time: start, Game: "g1", Op: InvokeOp, Latency: 1})
+	rl.Record(RunRecord{Time: start.Add(3 * time.Second), Game: "g1", Op: InvokeOp, Latency: 1})
+	rl.Record(RunRecord{Time: start, Game: "g2", Op: InvokeOp, Latency: 0.5})
+	rl.Record(RunRecord{Time: start.Add(time.Second), Game: "g2", Op: InvokeOp, Latency: 0.5})
+	require.NoError(t, rl.Close())
+
+	samples := sampleThinkTimes(t, ThinkTime{Kind: "replay", Trace: tracePath}, 4)
+	require.Equal(t, []time.Duration{2 * time.Second, 500 * time.Millisecond,
+		2 * time.Second, 500 * time.Millisecond}, samples, "expected the gaps of each game, cycled")
+}
+
+func TestThinkTimeRejectsInvalid(t *testing.T) {
+	invalid := []ThinkTime{
+		{},
+		{Kind: "poisson"},
+		{Kind: "constant", Value: -time.Second},
+		{Kind: "uniform", Min: 2 * time.Second, Max: time.Second},
+		{Kind: "exponential"},
+		{Kind: "normal", StdDev: -time.Second},
+		{Kind: "replay"},
+		{Kind: "replay", Trace: "missing.jsonl"},
+	}
+	for _, tt := range invalid {
+		_, err := tt.newSampler()
+		require.Error(t, err, "expected %v to be rejected", tt)
+	}
+}
+
+func TestThinkTimerOverrides(t *testing.T) {
+	tts := ThinkTimes{
+		Default: ThinkTime{Kind: "constant", Value: time.Second},
+		Players: map[string]ThinkTime{Player2: {Kind: "constant", Value: 2 * time.Second}},
+	}
+
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+	own := &ThinkTime{Kind: "constant", Value: 3 * time.Second}
+	think := newThinkTimer(tts, rand.New(rand.NewSource(42)))
+
+	steps := []scriptStep{
+		{player: p1},
+		{player: p2},
+		{player: &TFCClient{OrgID: Player3}, thinkTime: own},
+	}
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		actual, err := think.next(steps[i])
+		require.NoError(t, err)
+		require.Equal(t, expected, actual, "wrong think time for step %d", i)
+	}
+}
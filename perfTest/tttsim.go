@@ -0,0 +1,130 @@
+package tfc
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+)
+
+const tttCCPath = "github.com/stefanprisca/strategy-code/tictactoe"
+
+func init() {
+	RegisterSimContract(tttCCPath, newTTTSim)
+}
+
+var tttLines = [][]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+	{0, 4, 8}, {2, 4, 6},
+}
+
+// tttSim simulates the tic tac toe chaincode. The first player to move with a
+// mark owns that mark for the rest of the game.
+type tttSim struct {
+	contract *tttPb.TttContract
+}
+
+func newTTTSim() SimContract {
+	return &tttSim{}
+}
+
+func (ts *tttSim) Init(args [][]byte) error {
+	positions := make([]tttPb.Mark, 9)
+	for i := range positions {
+		positions[i] = tttPb.Mark_E
+	}
+
+	ts.contract = &tttPb.TttContract{
+		Positions: positions,
+		State:     tttPb.TttContract_XTURN,
+	}
+	return nil
+}
+
+func (ts *tttSim) Invoke(creator string, fcn string, args [][]byte) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing transaction arguments")
+	}
+
+	trxArgs := &tttPb.TrxArgs{}
+	err := proto.Unmarshal(args[0], trxArgs)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal arguments proto message <%v>: %s", args[0], err)
+	}
+
+	if trxArgs.Type != tttPb.TrxType_MOVE || trxArgs.MovePayload == nil {
+		return nil, fmt.Errorf("unknown transaction type %v", trxArgs.Type)
+	}
+
+	err = ts.move(creator, *trxArgs.MovePayload)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(ts.contract)
+}
+
+func (ts *tttSim) move(creator string, payload tttPb.MoveTrxPayload) error {
+	c := ts.contract
+
+	switch {
+	case c.State == tttPb.TttContract_XTURN && payload.Mark == tttPb.Mark_X:
+		if c.XPlayer != "" && c.XPlayer != creator {
+			return fmt.Errorf("mark %v belongs to %s, not %s", payload.Mark, c.XPlayer, creator)
+		}
+		if c.OPlayer == creator {
+			return fmt.Errorf("player %s already plays with %v", creator, tttPb.Mark_O)
+		}
+	case c.State == tttPb.TttContract_OTURN && payload.Mark == tttPb.Mark_O:
+		if c.OPlayer != "" && c.OPlayer != creator {
+			return fmt.Errorf("mark %v belongs to %s, not %s", payload.Mark, c.OPlayer, creator)
+		}
+		if c.XPlayer == creator {
+			return fmt.Errorf("player %s already plays with %v", creator, tttPb.Mark_X)
+		}
+	default:
+		return fmt.Errorf("cannot move %v in state %v", payload.Mark, c.State)
+	}
+
+	if payload.Position < 0 || int(payload.Position) >= len(c.Positions) {
+		return fmt.Errorf("position %d is outside the board", payload.Position)
+	}
+	if c.Positions[payload.Position] != tttPb.Mark_E {
+		return fmt.Errorf("position %d is already marked with %v",
+			payload.Position, c.Positions[payload.Position])
+	}
+
+	c.Positions[payload.Position] = payload.Mark
+	if payload.Mark == tttPb.Mark_X {
+		c.XPlayer = creator
+	} else {
+		c.OPlayer = creator
+	}
+
+	c.State = computeNextTTTState(c.Positions, payload.Mark)
+	return nil
+}
+
+func computeNextTTTState(positions []tttPb.Mark, lastMark tttPb.Mark) tttPb.TttContract_State {
+	for _, line := range tttLines {
+		if positions[line[0]] == lastMark &&
+			positions[line[1]] == lastMark &&
+			positions[line[2]] == lastMark {
+			if lastMark == tttPb.Mark_X {
+				return tttPb.TttContract_XWON
+			}
+			return tttPb.TttContract_OWON
+		}
+	}
+
+	for _, m := range positions {
+		if m == tttPb.Mark_E {
+			if lastMark == tttPb.Mark_X {
+				return tttPb.TttContract_OTURN
+			}
+			return tttPb.TttContract_XTURN
+		}
+	}
+	return tttPb.TttContract_TIE
+}
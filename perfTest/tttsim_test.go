@@ -0,0 +1,157 @@
+package tfc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	tttPb "github.com/stefanprisca/strategy-protobufs/tictactoe"
+	"github.com/stretchr/testify/require"
+)
+
+func tttMove(p *TFCClient, pos int32, mark tttPb.Mark) scriptStep {
+	return scriptStep{
+		message: &tttPb.TrxArgs{Type: tttPb.TrxType_MOVE, MovePayload: &tttPb.MoveTrxPayload{Position: pos, Mark: mark}},
+		player:  p,
+	}
+}
+
+func TestTTTSimScript(t *testing.T) {
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+
+	payloads, err := checkScript(scriptTTT1(p1, p2), tttCCPath)
+	require.NoError(t, err, "expected script to be legal")
+
+	contract := &tttPb.TttContract{}
+	err = proto.Unmarshal(payloads[len(payloads)-1], contract)
+	require.NoError(t, err, "could not unmarshal contract")
+
+	require.Equal(t, tttPb.TttContract_XWON, contract.State)
+	require.Equal(t, Player1, contract.XPlayer)
+	require.Equal(t, Player2, contract.OPlayer)
+	require.Equal(t, tttPb.Mark_X, contract.Positions[6])
+}
+
+func TestTTTSimTie(t *testing.T) {
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+	X, O := tttPb.Mark_X, tttPb.Mark_O
+
+	script := []scriptStep{
+		tttMove(p1, 0, X), tttMove(p2, 1, O), tttMove(p1, 2, X),
+		tttMove(p2, 4, O), tttMove(p1, 3, X), tttMove(p2, 5, O),
+		tttMove(p1, 7, X), tttMove(p2, 6, O), tttMove(p1, 8, X),
+	}
+
+	payloads, err := checkScript(script, tttCCPath)
+	require.NoError(t, err, "expected script to be legal")
+
+	contract := &tttPb.TttContract{}
+	err = proto.Unmarshal(payloads[len(payloads)-1], contract)
+	require.NoError(t, err, "could not unmarshal contract")
+	require.Equal(t, tttPb.TttContract_TIE, contract.State)
+}
+
+func TestTTTSimRejectsIllegalMoves(t *testing.T) {
+	p1, p2 := &TFCClient{OrgID: Player1}, &TFCClient{OrgID: Player2}
+	X, O := tttPb.Mark_X, tttPb.Mark_O
+
+	scripts := map[string][]scriptStep{
+		"wrong turn":        {tttMove(p1, 0, O)},
+		"double move":       {tttMove(p1, 0, X), tttMove(p1, 1, X)},
+		"occupied position": {tttMove(p1, 0, X), tttMove(p2, 0, O)},
+		"outside the board": {tttMove(p1, 9, X)},
+		"stolen mark":       {tttMove(p1, 0, X), tttMove(p2, 1, O), tttMove(p2, 2, X)},
+		"both marks":        {tttMove(p1, 0, X), tttMove(p1, 1, O)},
+		"game over": {
+			tttMove(p1, 0, X), tttMove(p2, 3, O), tttMove(p1, 1, X),
+			tttMove(p2, 4, O), tttMove(p1, 2, X), tttMove(p2, 5, O),
+		},
+	}
+
+	for name, script := range scripts {
+		payloads, err := checkScript(script, tttCCPath)
+		require.Error(t, err, "expected %s to be rejected", name)
+		require.Len(t, payloads, len(script)-1,
+			"expected only the last step of %s to be rejected", name)
+	}
+}
+
+func TestTTTSimGame(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	errOut := make(chan (error), 1)
+	metrics := newTestMetrics(t)
+	lease := leaseOrgs([]string{Player1, Player2}, metrics)
+
+	execTTTGameAsync(context.Background(), cfg, "simttt", metrics, errOut, lease)
+	require.Empty(t, lease.scheduler.bootstraps, "expected the bootstrap slot to be freed")
+	require.NoError(t, <-errOut)
+}
+
+func TestTTTSimStepTimeout(t *testing.T) {
+	cfg := simRunConfig("ttt")
+	cfg.StepTimeout = time.Second
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "ttt", Path: tttCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "simttttimeout", []string{Player1, Player2}, ccReq, newTestMetrics(t))
+	require.NoError(t, err, "could not bootstrap the game")
+	defer closePlayers(players)
+
+	// The second move is rejected, and retried until the step times out
+	p1, p2 := players[0], players[1]
+	script := []scriptStep{tttMove(p1, 0, tttPb.Mark_X), tttMove(p2, 0, tttPb.Mark_O)}
+	script[1].retry = &RetryPolicy{InitialBackoff: 100 * time.Millisecond, BackoffFactor: 1,
+		Retryable: []ErrorClass{RejectedError}}
+
+	st := time.Now()
+	_, err = runGameScript(context.Background(), cfg, newThinkTimer(cfg.ThinkTimes, cfg.gameRand("simttt")), script, "ttt", players)
+	require.Error(t, err, "expected the rejected move to time out")
+	require.Equal(t, &GameError{Phase: ScriptPhase, Game: "simttttimeout", Org: Player2,
+		Step: 1, Cause: context.DeadlineExceeded}, err)
+	require.True(t, time.Since(st) < 5*time.Second, "expected the step to give up after its timeout")
+}
+
+func TestTTTSimStepRetries(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	ccReq := resmgmt.InstantiateCCRequest{Name: "ttt", Path: tttCCPath, Version: "1.0"}
+	players, err := bootstrapChannel(context.Background(), cfg, "simtttretry", []string{Player1, Player2}, ccReq, newTestMetrics(t))
+	require.NoError(t, err, "could not bootstrap the game")
+	defer closePlayers(players)
+
+	p1, p2 := players[0], players[1]
+	script := []scriptStep{tttMove(p1, 0, tttPb.Mark_X), tttMove(p2, 0, tttPb.Mark_O)}
+
+	// Rejected moves are not retried by default
+	_, err = runGameScript(context.Background(), cfg, newThinkTimer(cfg.ThinkTimes, cfg.gameRand("simttt")), script, "ttt", players)
+	require.IsType(t, &GameError{}, err)
+	retryErr, ok := err.(*GameError).Cause.(*RetryError)
+	require.True(t, ok, "expected a retry error, got %s", err)
+	require.Equal(t, 1, retryErr.Attempts)
+	require.Equal(t, RejectedError, retryErr.Class)
+
+	script[1].retry = &RetryPolicy{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, BackoffFactor: 2,
+		Retryable: []ErrorClass{RejectedError}}
+	_, err = runGameScript(context.Background(), cfg, newThinkTimer(cfg.ThinkTimes, cfg.gameRand("simttt")), script[1:], "ttt", players)
+	require.IsType(t, &GameError{}, err)
+	retryErr, ok = err.(*GameError).Cause.(*RetryError)
+	require.True(t, ok, "expected a retry error, got %s", err)
+	require.Equal(t, 3, retryErr.Attempts, "expected the step to use all its attempts")
+}
+
+func TestTTTSimCancelledGame(t *testing.T) {
+	cfg := simRunConfig("ttt")
+
+	errOut := make(chan (error), 1)
+	metrics := newTestMetrics(t)
+	lease := leaseOrgs([]string{Player1, Player2}, metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	execTTTGameAsync(ctx, cfg, "simtttcancel", metrics, errOut, lease)
+	require.Empty(t, lease.scheduler.bootstraps, "expected the bootstrap slot to be freed")
+	require.Equal(t, newGameError(BootstrapPhase, "simtttcancel", Player1+","+Player2, context.Canceled), <-errOut)
+}